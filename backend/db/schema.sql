@@ -1,6 +1,9 @@
 -- Enable foreign key constraints
 PRAGMA foreign_keys = ON;
 
+-- Number of migrations in models/migrate.go this schema already includes
+PRAGMA user_version = 6;
+
 -- Users table
 CREATE TABLE IF NOT EXISTS users (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -12,17 +15,96 @@ CREATE TABLE IF NOT EXISTS users (
     gender TEXT NOT NULL CHECK(gender IN ('male', 'female')),
     hashed_password TEXT NOT NULL CHECK (LENGTH(hashed_password) > 0),
     profile_img TEXT NOT NULL,
+    role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'moderator', 'member')), -- first admin is promoted by hand
+    email_verified_at DATETIME DEFAULT NULL,
+    totp_secret TEXT DEFAULT NULL,
+    totp_enabled_at DATETIME DEFAULT NULL,
+    totp_last_step INTEGER NOT NULL DEFAULT 0,
+    deleted_at DATETIME DEFAULT NULL, -- set when the account was anonymized
+    last_seen_at DATETIME DEFAULT NULL, -- last time a chat connection was open
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 
--- Sessions table
+-- Sessions table (one row per signed-in device)
 CREATE TABLE IF NOT EXISTS sessions (
-    user_id INTEGER NOT NULL UNIQUE,
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
     token TEXT NOT NULL UNIQUE,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     expires_at DATETIME,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
+-- Refresh tokens table ("remember me"), rotated on every use.
+-- All tokens descending from one sign-in share a family so reuse of an
+-- already rotated token can revoke the whole chain.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    family TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    session_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL
+);
+
+-- Personal access tokens for bots and scripts (only the hash is stored)
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Pending second factor challenges, issued after a valid password on 2FA accounts
+CREATE TABLE IF NOT EXISTS mfa_challenges (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    remember_me BOOLEAN NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- One-time 2FA recovery codes
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Failed sign in tracking, keyed by identifier (email/username) or client IP
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at DATETIME NOT NULL,
+    locked_until DATETIME DEFAULT NULL
+);
+
+-- Password reset tokens table (single use, only the hash is stored)
+CREATE TABLE IF NOT EXISTS password_resets (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 -- Conversations table
 CREATE TABLE IF NOT EXISTS conversations (
     id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -61,8 +143,29 @@ CREATE TABLE IF NOT EXISTS posts (
     user_id INTEGER NOT NULL,
     title TEXT NOT NULL,
     content TEXT NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1, -- bumped on every edit, for optimistic concurrency
+    edited_at DATETIME DEFAULT NULL,
+    deleted_at DATETIME DEFAULT NULL, -- soft deleted: shown as "[removed]" until restored or purged
+    deleted_by INTEGER DEFAULT NULL,
+    delete_reason TEXT NOT NULL DEFAULT '',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Post revisions table (every version of a post, the current one included)
+CREATE TABLE IF NOT EXISTS post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    content TEXT NOT NULL,
+    category_ids TEXT NOT NULL DEFAULT '[]', -- JSON array
+    editor_id INTEGER,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (post_id, version),
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE SET NULL
 );
 
 -- PostCategories join table (many-to-many)
@@ -80,9 +183,57 @@ CREATE TABLE IF NOT EXISTS comments (
     post_id INTEGER NOT NULL,
     user_id INTEGER NOT NULL,
     content TEXT NOT NULL CHECK (LENGTH(content) > 0),
+    deleted_at DATETIME DEFAULT NULL, -- soft deleted: shown as "[removed]" until restored or purged
+    deleted_by INTEGER DEFAULT NULL,
+    delete_reason TEXT NOT NULL DEFAULT '',
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
-    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
+    FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- Personal data export jobs (archives too big to build within a request)
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+    file_path TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    completed_at DATETIME DEFAULT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Follows table (follower_id follows followee_id)
+CREATE TABLE IF NOT EXISTS follows (
+    follower_id INTEGER NOT NULL,
+    followee_id INTEGER NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id != followee_id),
+    FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Blocks table (blocker_id blocks or mutes blocked_id)
+CREATE TABLE IF NOT EXISTS blocks (
+    blocker_id INTEGER NOT NULL,
+    blocked_id INTEGER NOT NULL,
+    kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (blocker_id, blocked_id),
+    CHECK (blocker_id != blocked_id),
+    FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- User settings table (one versioned JSON document per user, see models/settings.go)
+CREATE TABLE IF NOT EXISTS user_settings (
+    user_id INTEGER PRIMARY KEY,
+    version INTEGER NOT NULL,
+    data TEXT NOT NULL CHECK (json_valid(data)),
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
 
 -- Logs table
@@ -91,6 +242,9 @@ CREATE TABLE IF NOT EXISTS logs (
     user_id INTEGER,
     log_level TEXT NOT NULL CHECK (log_level IN ('INFO', 'WARNING', 'ERROR')),
     origin TEXT,
+    event TEXT NOT NULL DEFAULT '',  -- audit event, e.g. 'signin_failed'
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
     message TEXT NOT NULL,
     created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
     FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE SET NULL
@@ -99,10 +253,15 @@ CREATE TABLE IF NOT EXISTS logs (
 -- Indexes
 --> users
 CREATE INDEX idx_users_email ON users(email);        -- For login
-CREATE INDEX idx_users_username ON users(username);  -- For search
+CREATE UNIQUE INDEX idx_users_username ON users(username);  -- For search, and one account per username
 
 --> sessions
-CREATE INDEX idx_sessions_user_id ON sessions(user_id);  -- You already have this; good for token validation
+CREATE INDEX idx_sessions_user_id ON sessions(user_id);  -- For listing a user's devices
+CREATE INDEX idx_refresh_tokens_family ON refresh_tokens(family);
+CREATE INDEX idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+CREATE INDEX idx_password_resets_user_id ON password_resets(user_id);
+CREATE INDEX idx_api_tokens_user_id ON api_tokens(user_id);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes(user_id);
 
 --> posts
 CREATE INDEX idx_posts_user_id ON posts(user_id);         -- Already present; useful for profile filtering
@@ -117,6 +276,16 @@ CREATE INDEX idx_conversations_last_message_at ON conversations(last_message_at)
 CREATE INDEX idx_comments_post_id ON comments(post_id);       -- For post-related comment retrieval
 CREATE INDEX idx_comments_created_at ON comments(created_at); -- For ordering
 
+--> export jobs
+CREATE INDEX idx_export_jobs_user_id ON export_jobs(user_id);
+
+--> follows
+CREATE INDEX idx_follows_followee_id ON follows(followee_id);  -- For follower lists
+
+--> blocks
+CREATE INDEX idx_blocks_blocked_id ON blocks(blocked_id);  -- For checking both directions in chat
+
 --> logs
 CREATE INDEX idx_logs_user_id ON logs(user_id);        -- Optional, if filtering logs per user
 CREATE INDEX idx_logs_created_at ON logs(created_at);  -- For time-based log querying
+CREATE INDEX idx_logs_event ON logs(event);            -- For audit log filtering
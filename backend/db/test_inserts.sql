@@ -1,15 +1,15 @@
 -- Users inserts
-INSERT OR IGNORE INTO users (first_name, last_name, username, email, birth_date, gender, hashed_password, profile_img) VALUES
-('Alice', 'Smith', 'alice_s', 'alice@example.com', 25, 'female', 'hashed_pw_1', 'alice.jpg'),
-('Bob', 'Johnson', 'bobbyj', 'bob@example.com', 30, 'male', 'hashed_pw_2', 'bob.png'),
-('Charlie', 'Brown', 'charlieb', 'charlie@example.com', 22, 'male', 'hashed_pw_3', 'charlie.jpg'),
-('Diana', 'Prince', 'wonderd', 'diana@example.com', 28, 'female', 'hashed_pw_4', 'diana.png'),
-('Ethan', 'Hunt', 'ethanh', 'ethan@example.com', 35, 'male', 'hashed_pw_5', 'ethan.jpg'),
-('Fiona', 'Gallagher', 'fionag', 'fiona@example.com', 27, 'female', 'hashed_pw_6', 'fiona.png'),
-('George', 'Michaels', 'georgem', 'george@example.com', 24, 'male', 'hashed_pw_7', 'george.jpg'),
-('Hannah', 'Montana', 'hannahm', 'hannah@example.com', 29, 'female', 'hashed_pw_8', 'hannah.png'),
-('Ian', 'Sommerhalder', 'ians', 'ian@example.com', 26, 'male', 'hashed_pw_9', 'ian.jpg'),
-('Jenna', 'Marbles', 'jennam', 'jenna@example.com', 31, 'female', 'hashed_pw_10', 'jenna.png');
+INSERT OR IGNORE INTO users (first_name, last_name, username, email, birth_date, gender, hashed_password, profile_img, email_verified_at) VALUES
+('Alice', 'Smith', 'alice_s', 'alice@example.com', 25, 'female', 'hashed_pw_1', 'alice.jpg', CURRENT_TIMESTAMP),
+('Bob', 'Johnson', 'bobbyj', 'bob@example.com', 30, 'male', 'hashed_pw_2', 'bob.png', CURRENT_TIMESTAMP),
+('Charlie', 'Brown', 'charlieb', 'charlie@example.com', 22, 'male', 'hashed_pw_3', 'charlie.jpg', CURRENT_TIMESTAMP),
+('Diana', 'Prince', 'wonderd', 'diana@example.com', 28, 'female', 'hashed_pw_4', 'diana.png', CURRENT_TIMESTAMP),
+('Ethan', 'Hunt', 'ethanh', 'ethan@example.com', 35, 'male', 'hashed_pw_5', 'ethan.jpg', CURRENT_TIMESTAMP),
+('Fiona', 'Gallagher', 'fionag', 'fiona@example.com', 27, 'female', 'hashed_pw_6', 'fiona.png', CURRENT_TIMESTAMP),
+('George', 'Michaels', 'georgem', 'george@example.com', 24, 'male', 'hashed_pw_7', 'george.jpg', CURRENT_TIMESTAMP),
+('Hannah', 'Montana', 'hannahm', 'hannah@example.com', 29, 'female', 'hashed_pw_8', 'hannah.png', CURRENT_TIMESTAMP),
+('Ian', 'Sommerhalder', 'ians', 'ian@example.com', 26, 'male', 'hashed_pw_9', 'ian.jpg', CURRENT_TIMESTAMP),
+('Jenna', 'Marbles', 'jennam', 'jenna@example.com', 31, 'female', 'hashed_pw_10', 'jenna.png', CURRENT_TIMESTAMP);
 
 
 -- Conversations inserts
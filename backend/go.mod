@@ -5,8 +5,11 @@ go 1.23.0
 toolchain go1.23.9
 
 require (
-	github.com/google/uuid v1.6.0 // indirect
-	github.com/gorilla/websocket v1.5.3 // indirect
-	github.com/mattn/go-sqlite3 v1.14.28 // indirect
-	golang.org/x/crypto v0.38.0 // indirect
+	github.com/google/uuid v1.6.0
+	github.com/gorilla/websocket v1.5.3
+	github.com/mattn/go-sqlite3 v1.14.28
+	golang.org/x/crypto v0.38.0
+	golang.org/x/image v0.25.0
 )
+
+require golang.org/x/sys v0.33.0 // indirect
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"echohub/models"
+)
+
+// UpdateProfile edits the signed in user's names, username and email
+func (App *WebApp) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var changes models.User
+	if err := decodeJson(r, &changes); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	changes.ID = user.ID
+
+	if err := App.Users.ValidateUser(&changes, "profile"); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	emailChanged, err := App.Users.UpdateProfile(changes)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	updated, err := App.Users.GetUserByID(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if emailChanged {
+		App.sendVerificationMail(updated.ID, updated.FirstName, updated.Email)
+	}
+
+	encodeJson(w, http.StatusOK, updated)
+}
+
+// ChangePassword sets a new password given the current one, signs out every
+// other device and revokes the API tokens
+func (App *WebApp) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	session, okSession := r.Context().Value(contextKeySession).(*models.Session)
+	if !ok || !okSession {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var change models.PasswordChange
+	if err := decodeJson(r, &change); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := App.Users.CheckPassword(user.ID, change.CurrentPassword); err != nil {
+		if errors.Is(err, models.ErrWrongPassword) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Users.ValidatePassword(change.Password, change.RepeatedPass); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	if err := App.Users.UpdatePassword(user.ID, change.Password); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Sessions.DeleteUserSessions(user.ID, session.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if err := App.APITokens.DeleteUserTokens(user.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	App.audit(r, user.ID, models.EventPasswordChanged, models.LogInfo, "password changed, other sessions and api tokens revoked")
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// DeleteAccount closes the signed in user's account, either anonymizing or
+// deleting what they authored
+func (App *WebApp) DeleteAccount(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var deletion models.AccountDeletion
+	if err := decodeJson(r, &deletion); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	if deletion.Mode == "" {
+		deletion.Mode = models.DeleteModeAnonymize
+	}
+	if deletion.Mode != models.DeleteModeAnonymize && deletion.Mode != models.DeleteModeCascade {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"mode": "mode must be 'anonymize' or 'delete'"}})
+		return
+	}
+
+	if err := App.Users.CheckPassword(user.ID, deletion.Password); err != nil {
+		if errors.Is(err, models.ErrWrongPassword) {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	var err error
+	if deletion.Mode == models.DeleteModeCascade {
+		err = App.Users.DeleteUser(user.ID)
+	} else {
+		err = App.Users.AnonymizeUser(user.ID)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	App.releaseAvatar(user.ProfileImg)
+	// their rows went with the account, the archives hold all of its personal data
+	removeExportFiles(user.ID)
+
+	clearAuthCookies(w)
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// UploadAvatar replaces the signed in user's avatar with the image sent in
+// the "avatar" field of a multipart form
+func (App *WebApp) UploadAvatar(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	// leave room for the multipart framing around the file
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxAvatarBytes+64<<10)
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeValidationError(w, &models.ValidationError{Fields: map[string]string{"avatar": models.ErrAvatarTooLarge.Error()}})
+			return
+		}
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"avatar": "avatar file is required"}})
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, models.MaxAvatarBytes+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	profileImg, err := models.SaveAvatar(data)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	previous, err := App.Users.UpdateAvatar(user.ID, profileImg)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if previous != profileImg {
+		App.releaseAvatar(previous)
+	}
+
+	encodeJson(w, http.StatusOK, map[string]any{
+		"profile_img": profileImg,
+		"variants":    models.AvatarVariants(profileImg),
+	})
+}
+
+// releaseAvatar deletes the files of an avatar nobody shows anymore
+func (App *WebApp) releaseAvatar(profileImg string) {
+	inUse, err := App.Users.AvatarInUse(profileImg)
+	if err != nil || inUse {
+		return
+	}
+	if err := models.RemoveAvatar(profileImg); err != nil {
+		log.Printf("failed to remove avatar %s: %v", profileImg, err)
+	}
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"echohub/models"
+)
+
+func (app *WebApp) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var category models.Category
+	if err := decodeJson(r, &category); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := models.ValidateCategory(&category); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	if err := app.Categories.InsertCategory(category); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusCreated, nil)
+}
+
+func (app *WebApp) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	if _, err := app.Categories.GetCategoryByID(categoryID); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var category models.Category
+	if err := decodeJson(r, &category); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	category.ID = categoryID
+
+	if err := models.ValidateCategory(&category); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	if err := app.Categories.UpdateCategory(category); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, category)
+}
+
+func (app *WebApp) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	categoryID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	if _, err := app.Categories.GetCategoryByID(categoryID); err != nil {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if err := app.Categories.DeleteCategory(categoryID); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// SetUserRole promotes or demotes a user. Admins can't change their own role
+// so there is always at least one admin left.
+func (app *WebApp) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	admin, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	if userID == admin.ID {
+		writeError(w, http.StatusForbidden, "you can't change your own role")
+		return
+	}
+
+	var request models.User
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := app.Users.UpdateRole(userID, request.Role); err != nil {
+		var invalid *models.ValidationError
+		switch {
+		case errors.As(err, &invalid):
+			writeValidationError(w, err)
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "")
+		default:
+			writeError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+	app.audit(r, userID, models.EventRoleChanged, models.LogWarning,
+		fmt.Sprintf("role set to %s by %s (user %d)", request.Role, admin.UserName, admin.ID))
+
+	encodeJson(w, http.StatusOK, nil)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"echohub/models"
+)
+
+// ListAPITokens returns the user's personal access tokens (never their secret)
+func (App *WebApp) ListAPITokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	tokens, err := App.APITokens.GetUserTokens(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	encodeJson(w, http.StatusOK, tokens)
+}
+
+// CreateAPIToken creates a named, scoped token. Its value is only shown in this response.
+func (App *WebApp) CreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var token models.APIToken
+	if err := decodeJson(r, &token); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := models.ValidateAPIToken(&token); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	token.UserID = user.ID
+
+	created, err := App.APITokens.InsertToken(token)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusCreated, created)
+}
+
+// RevokeAPIToken deletes one of the user's tokens
+func (App *WebApp) RevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	tokenID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := App.APITokens.DeleteToken(user.ID, tokenID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, nil)
+}
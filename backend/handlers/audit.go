@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"echohub/models"
+)
+
+const (
+	auditPageSize    = 50
+	auditMaxPageSize = 200
+)
+
+// audit records a security event in the logs table with the request's IP
+// and user agent, userID 0 meaning unknown
+func (App *WebApp) audit(r *http.Request, userID int, event, level, message string) {
+	entry := models.Log{
+		UserID:    sql.NullInt64{Int64: int64(userID), Valid: userID != 0},
+		Level:     level,
+		Origin:    "audit",
+		Event:     event,
+		IP:        clientIP(r),
+		UserAgent: r.UserAgent(),
+		Message:   message,
+	}
+	if err := App.Logs.InsertLog(entry); err != nil {
+		log.Println("❌", err)
+	}
+}
+
+// PruneLogs deletes log entries older than retention, once at startup and
+// then every hour. It never returns.
+func (App *WebApp) PruneLogs(retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		pruned, err := App.Logs.PruneLogs(time.Now().Add(-retention))
+		if err != nil {
+			log.Println("❌ Failed to prune logs:", err)
+		} else if pruned > 0 {
+			log.Printf("pruned %d log entries older than %s\n", pruned, retention)
+		}
+		<-ticker.C
+	}
+}
+
+// ListAuditLogs pages through the logs, newest first. Query parameters:
+// user_id, level, origin, event, ip, since and until (RFC 3339 or
+// YYYY-MM-DD), start_id (id of the last entry seen) and n.
+func (App *WebApp) ListAuditLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r.URL.Query())
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	logs, err := App.Logs.GetLogs(filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, logs)
+}
+
+func parseLogFilter(query url.Values) (*models.LogFilter, error) {
+	filter := &models.LogFilter{
+		Level:  query.Get("level"),
+		Origin: query.Get("origin"),
+		Event:  query.Get("event"),
+		IP:     query.Get("ip"),
+	}
+	invalid := map[string]string{}
+
+	filter.UserID = queryInt(query, "user_id", 0, 1, math.MaxInt32, invalid)
+	filter.StartID = queryInt(query, "start_id", -1, 1, math.MaxInt32, invalid)
+	filter.NLog = queryInt(query, "n", auditPageSize, 1, auditMaxPageSize, invalid)
+
+	date := func(name string, dst *time.Time) {
+		value := query.Get(name)
+		if value == "" {
+			return
+		}
+		for _, layout := range []string{time.RFC3339, time.DateOnly} {
+			if t, err := time.Parse(layout, value); err == nil {
+				*dst = t
+				return
+			}
+		}
+		invalid[name] = name + " must be an RFC 3339 date time or a YYYY-MM-DD date"
+	}
+	date("since", &filter.Since)
+	date("until", &filter.Until)
+
+	if len(invalid) > 0 {
+		return nil, &models.ValidationError{Fields: invalid}
+	}
+	return filter, nil
+}
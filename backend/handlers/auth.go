@@ -1,7 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"echohub/models"
 )
@@ -9,19 +15,21 @@ import (
 func (App *WebApp) SignUp(w http.ResponseWriter, r *http.Request) {
 	var NewUser models.User
 	if decodeErr := decodeJson(r, &NewUser); decodeErr != nil {
-		http.Error(w, "Invalid JSON format.", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid JSON format")
 		return
 	}
 
 	if err := App.Users.ValidateUser(&NewUser, "newUser"); err != nil {
-		encodeJson(w, http.StatusBadRequest, nil)
+		writeValidationError(w, err)
 		return
 	}
 
-	if err := App.Users.InsertUser(NewUser); err != nil {
-		encodeJson(w, http.StatusInternalServerError, nil)
+	userID, err := App.Users.InsertUser(NewUser)
+	if err != nil {
+		writeValidationError(w, err)
 		return
 	}
+	App.sendVerificationMail(userID, NewUser.FirstName, NewUser.Email)
 
 	if err := encodeJson(w, http.StatusCreated, nil); err != nil {
 		http.Error(w, "failed to encode object.", http.StatusInternalServerError)
@@ -29,35 +37,145 @@ func (App *WebApp) SignUp(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// GetPolicy returns the password and username rules, for the signup form
+func (App *WebApp) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	encodeJson(w, http.StatusOK, App.Users.ActivePolicy())
+}
+
 func (App *WebApp) SignIn(w http.ResponseWriter, r *http.Request) {
 	var User *models.User
 	if decodeErr := decodeJson(r, &User); decodeErr != nil {
-		http.Error(w, "Invalid JSON format", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "invalid JSON format")
+		return
+	}
+
+	// lockouts apply whether or not the account exists so they can't be used to enumerate users
+	identifierKey := models.LoginIdentifierKey(User)
+	ipKey := models.LoginIPKey(clientIP(r))
+	lockedFor, err := App.LoginAttempts.LockedFor(identifierKey, ipKey)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
+	if lockedFor > 0 {
+		writeLockedOut(w, lockedFor)
+		return
+	}
+
 	if err := App.Users.ValidateUser(User, "User"); err != nil {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		App.audit(r, User.ID, models.EventSignInFailed, models.LogWarning, "failed sign in for "+identifierKey+": "+err.Error())
+		App.recordLoginFailure(r, User, identifierKey, models.LoginIdentifierThreshold)
+		App.recordLoginFailure(r, User, ipKey, models.LoginIPThreshold)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
-	session, err := App.Sessions.GenerateNewSession(User.ID)
+
+	hasTOTP, err := App.Users.HasTOTP(User.ID)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if hasTOTP {
+		// the password alone doesn't clear the lockout: wrong codes count
+		// against the account too, and a fresh challenge mustn't reset them
+		account, err := App.Users.GetUserByID(User.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		}
+		lockedFor, err := App.LoginAttempts.LockedFor(append(models.LoginAccountKeys(account), ipKey)...)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		}
+		if lockedFor > 0 {
+			writeLockedOut(w, lockedFor)
+			return
+		}
+
+		challenge, err := App.Sessions.CreateMFAChallenge(User.ID, User.RememberMe)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		encodeJson(w, http.StatusAccepted, models.TwoFactor{Required: true, Challenge: challenge})
+		return
+	}
+
+	if err := App.resetLoginFailures(r, User.ID, identifierKey); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
-	cokkie, err := App.Sessions.UpSertSession(session)
+
+	App.startSession(w, r, User.ID, User.RememberMe)
+}
+
+// writeLockedOut answers a sign in attempt made while locked out
+func writeLockedOut(w http.ResponseWriter, lockedFor time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockedFor.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, "too many failed sign in attempts, try again later")
+}
+
+// recordLoginFailure counts a failed sign in and logs the lockout it may trigger
+func (App *WebApp) recordLoginFailure(r *http.Request, user *models.User, key string, threshold int) {
+	lockout, err := App.LoginAttempts.RecordFailure(key, threshold)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, err.Error())
+		log.Println("❌ Failed to record sign in failure:", err)
 		return
 	}
+	if lockout > 0 {
+		App.audit(r, user.ID, models.EventSignInLocked, models.LogWarning,
+			fmt.Sprintf("sign in locked for %s for %s", key, lockout))
+	}
+}
+
+// resetLoginFailures forgets the failures of keys once a sign in fully
+// succeeded, and logs the lockouts it lifts
+func (App *WebApp) resetLoginFailures(r *http.Request, userID int, keys ...string) error {
+	for _, key := range keys {
+		wasLocked, err := App.LoginAttempts.Reset(key)
+		if err != nil {
+			return err
+		}
+		if wasLocked {
+			App.audit(r, userID, models.EventSignInUnlocked, models.LogInfo, "sign in unlocked for "+key+" after a successful sign in")
+		}
+	}
+	return nil
+}
+
+// startSession signs the user in on this device: it creates the session,
+// optionally a "remember me" refresh token, and answers with the user.
+func (App *WebApp) startSession(w http.ResponseWriter, r *http.Request, userID int, remember bool) {
+	session, err := App.Sessions.GenerateNewSession(userID, r.UserAgent(), clientIP(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	cokkie, err := App.Sessions.InsertSession(&session)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if remember {
+		refresh, err := App.Sessions.IssueRefreshToken(session)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		refreshCookie := models.RefreshCookie(refresh)
+		http.SetCookie(w, &refreshCookie)
+	}
 	// TODO get user by id and encode it as response +token
 	// and change getting that token logic on client side
-	User, err = App.Users.GetUserByID(User.ID)
+	User, err := App.Users.GetUserByID(userID)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	User.Token = session.Token
 	http.SetCookie(w, &cokkie)
+	App.audit(r, userID, models.EventSignIn, models.LogInfo, fmt.Sprintf("signed in (session %d, remember me: %t)", session.ID, remember))
 
 	if err := encodeJson(w, http.StatusOK, &User); err != nil {
 		http.Error(w, "failed to encode object.", http.StatusInternalServerError)
@@ -65,18 +183,63 @@ func (App *WebApp) SignIn(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// Refresh exchanges the "remember me" refresh token for a new session.
+// The refresh token is rotated on every call. A token another request rotated
+// a moment ago gets 409 Conflict: the browser already holds the new cookies.
+func (App *WebApp) Refresh(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie("refresh_token")
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	session, refresh, err := App.Sessions.RotateRefreshToken(cookie.Value, r.UserAgent(), clientIP(r))
+	if err != nil {
+		if errors.Is(err, models.ErrRefreshTokenRotated) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, models.ErrInvalidRefreshToken) || errors.Is(err, models.ErrRefreshTokenReused) {
+			if errors.Is(err, models.ErrRefreshTokenReused) {
+				App.audit(r, refresh.UserID, models.EventRefreshReused, models.LogWarning,
+					fmt.Sprintf("refresh token reuse detected, token family %s and its sessions revoked", refresh.Family))
+			}
+			clearAuthCookies(w)
+			writeError(w, http.StatusUnauthorized, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	sessionCookie := models.SessionCookie(session)
+	refreshCookie := models.RefreshCookie(refresh)
+	http.SetCookie(w, &sessionCookie)
+	http.SetCookie(w, &refreshCookie)
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
 func (App *WebApp) SignOut(w http.ResponseWriter, r *http.Request) {
-	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	session, ok := r.Context().Value(contextKeySession).(*models.Session)
 	if !ok {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 
-	if err := App.Sessions.DeleteSession(user.ID); err != nil {
-		encodeJson(w, http.StatusInternalServerError, nil)
+	if err := App.Sessions.DeleteSession(session.Token); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
+	App.audit(r, session.UserID, models.EventSignOut, models.LogInfo, fmt.Sprintf("signed out (session %d)", session.ID))
+
+	clearAuthCookies(w)
+
+	encodeJson(w, http.StatusOK, nil)
+}
 
+// clearAuthCookies drops both the session and the refresh cookie from the browser
+func clearAuthCookies(w http.ResponseWriter) {
 	http.SetCookie(w, &http.Cookie{
 		Name:     "session_id",
 		Value:    "",
@@ -84,14 +247,19 @@ func (App *WebApp) SignOut(w http.ResponseWriter, r *http.Request) {
 		HttpOnly: true,
 		MaxAge:   -1,
 	})
-
-	encodeJson(w, http.StatusOK, nil)
+	http.SetCookie(w, &http.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/refresh",
+		HttpOnly: true,
+		MaxAge:   -1,
+	})
 }
 
 func (App *WebApp) LoggedUser(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"echohub/models"
+)
+
+const (
+	exportSyncLimit = 2000 // posts + comments + messages built within the request
+	exportPageSize  = 200
+	exportDir       = "./db/exports"
+	exportTimeout   = time.Hour // background jobs still pending after this failed
+)
+
+// exportData is the data.json document of a personal data export
+type exportData struct {
+	ExportedAt    time.Time             `json:"exported_at"`
+	Profile       *models.User          `json:"profile"`
+	Sessions      []models.Session      `json:"sessions"`
+	Posts         []models.Post         `json:"posts"`
+	Comments      []models.Comment      `json:"comments"`
+	Conversations []models.Conversation `json:"conversations"`
+	Messages      []models.Message      `json:"messages"`
+	Settings      *models.Settings      `json:"settings"`
+}
+
+// ExportData sends the user a ZIP archive of everything stored about them.
+// Small accounts get it right away; bigger ones get a background job to poll.
+func (App *WebApp) ExportData(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	count, err := App.Exports.CountUserData(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if count <= exportSyncLimit {
+		var buf bytes.Buffer
+		if err := App.writeExport(&buf, user); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFileName(user)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+		return
+	}
+
+	// don't pile up jobs if the user keeps asking
+	job, err := App.Exports.GetPendingJob(user.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		job, err = App.Exports.InsertJob(user.ID)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		go App.runExport(job, *user)
+	}
+
+	w.Header().Set("Location", "/me/export/"+strconv.Itoa(job.ID))
+	encodeJson(w, http.StatusAccepted, job)
+}
+
+// GetExport reports the state of an export job, or downloads it once ready
+func (App *WebApp) GetExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	jobID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	job, err := App.Exports.GetJob(user.ID, jobID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	switch job.Status {
+	case models.ExportPending:
+		encodeJson(w, http.StatusAccepted, job)
+	case models.ExportFailed:
+		writeError(w, http.StatusInternalServerError, job.Error)
+	default:
+		if _, err := os.Stat(job.FilePath); err != nil {
+			writeError(w, http.StatusGone, "this export expired, please ask for a new one")
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportFileName(user)))
+		http.ServeFile(w, r, job.FilePath)
+	}
+}
+
+// runExport builds a queued export on disk and records the outcome
+func (App *WebApp) runExport(job models.ExportJob, user models.User) {
+	path, err := App.buildExportFile(job, &user)
+	if err != nil {
+		log.Printf("export %d for user %d failed: %v", job.ID, user.ID, err)
+		if err := App.Exports.FailJob(job.ID, "export could not be built"); err != nil {
+			log.Println("can't mark export as failed:", err)
+		}
+		return
+	}
+	if err := App.Exports.CompleteJob(job.ID, path); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			// the account was deleted while the export was being built
+			os.Remove(path)
+			return
+		}
+		log.Println("can't mark export as ready:", err)
+	}
+}
+
+// PruneExports fails the jobs that have been pending for more than
+// exportTimeout and deletes the exports older than retention (0 keeps them),
+// once at startup and then every hour. It never returns.
+func (App *WebApp) PruneExports(retention time.Duration) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		if failed, err := App.Exports.FailStaleJobs(time.Now().Add(-exportTimeout)); err != nil {
+			log.Println("❌ Failed to fail stale exports:", err)
+		} else if failed > 0 {
+			log.Printf("failed %d exports pending for more than %s\n", failed, exportTimeout)
+		}
+
+		if retention > 0 {
+			App.expireExports(retention)
+		}
+		<-ticker.C
+	}
+}
+
+func (App *WebApp) expireExports(retention time.Duration) {
+	paths, err := App.Exports.ExpireJobs(time.Now().Add(-retention))
+	if err != nil {
+		log.Println("❌ Failed to expire exports:", err)
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("❌ Failed to remove export %s: %v", path, err)
+		}
+	}
+	if len(paths) > 0 {
+		log.Printf("removed %d exports older than %s\n", len(paths), retention)
+	}
+}
+
+// removeExportFiles deletes every export archive built for a user
+func removeExportFiles(userID int) {
+	paths, err := filepath.Glob(filepath.Join(exportDir, fmt.Sprintf("%d-*.zip", userID)))
+	if err != nil {
+		log.Println("❌ Failed to list exports:", err)
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("❌ Failed to remove export %s: %v", path, err)
+		}
+	}
+}
+
+func (App *WebApp) buildExportFile(job models.ExportJob, user *models.User) (string, error) {
+	if err := os.MkdirAll(exportDir, 0o700); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(exportDir, fmt.Sprintf("%d-%d.zip", user.ID, job.ID))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	if err := App.writeExport(file, user); err != nil {
+		file.Close()
+		os.Remove(path)
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// writeExport writes the archive: data.json plus the user's avatar
+func (App *WebApp) writeExport(w io.Writer, user *models.User) error {
+	data, err := App.collectExport(user)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+
+	doc, err := archive.Create("data.json")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(doc)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(data); err != nil {
+		return err
+	}
+
+	if err := addAvatar(archive, user.ProfileImg); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func (App *WebApp) collectExport(user *models.User) (*exportData, error) {
+	data := &exportData{ExportedAt: time.Now(), Profile: user}
+
+	var err error
+	if data.Sessions, err = App.Sessions.GetUserSessions(user.ID); err != nil {
+		return nil, fmt.Errorf("sessions: %w", err)
+	}
+	if data.Settings, err = App.Settings.GetSettings(user.ID); err != nil {
+		return nil, fmt.Errorf("settings: %w", err)
+	}
+
+	postFilter := &models.PostFilter{Target: "user", StartID: -1, NPost: exportPageSize}
+	for {
+		posts, err, status := App.Posts.FilterPosts(postFilter, user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("posts: %w", err)
+		}
+		if status == http.StatusNoContent {
+			break
+		}
+		data.Posts = append(data.Posts, posts...)
+		postFilter.StartID = posts[len(posts)-1].ID
+	}
+
+	commentFilter := &models.CommentsFilter{StartID: -1, NComment: exportPageSize}
+	for {
+		comments, err := App.Comments.GetUserComments(user.ID, commentFilter)
+		if err != nil {
+			return nil, fmt.Errorf("comments: %w", err)
+		}
+		if len(comments) == 0 {
+			break
+		}
+		data.Comments = append(data.Comments, comments...)
+		commentFilter.StartID = comments[len(comments)-1].ID
+	}
+
+	if data.Conversations, err = App.Conversations.GetUserConversationsByRecentOrder(user.ID); err != nil {
+		return nil, fmt.Errorf("conversations: %w", err)
+	}
+	for _, conv := range data.Conversations {
+		msgFilter := &models.MessagesFilter{
+			ConversationID: sql.NullInt64{Int64: int64(conv.ID), Valid: true},
+			StartID:        -1,
+			NMsg:           exportPageSize,
+		}
+		for {
+			messages, err := App.Messages.GetMessages(user.ID, msgFilter)
+			if err != nil {
+				return nil, fmt.Errorf("messages: %w", err)
+			}
+			if len(messages) == 0 {
+				break
+			}
+			data.Messages = append(data.Messages, messages...)
+			msgFilter.StartID = messages[len(messages)-1].ID
+		}
+	}
+
+	return data, nil
+}
+
+// addAvatar copies the avatar served under /public/ into the archive
+func addAvatar(archive *zip.Writer, profileImg string) error {
+	rel, ok := strings.CutPrefix(profileImg, "/public/")
+	if !ok {
+		return nil
+	}
+	file, err := os.Open(filepath.Join("../frontend/public", filepath.Clean("/"+rel)))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	dst, err := archive.Create("avatar/" + filepath.Base(rel))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, file)
+	return err
+}
+
+func exportFileName(user *models.User) string {
+	return fmt.Sprintf("echohub-export-%s.zip", user.UserName)
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"echohub/models"
@@ -19,7 +23,7 @@ func (app *WebApp) GetCategories(w http.ResponseWriter, r *http.Request) {
 	case "all":
 		categories, err := app.Categories.GetAllCategories()
 		if err != nil {
-			encodeJson(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		encodeJson(w, http.StatusOK, categories)
@@ -27,7 +31,7 @@ func (app *WebApp) GetCategories(w http.ResponseWriter, r *http.Request) {
 	default:
 		category, err := app.Categories.GetCategoryByID(category.ID)
 		if err != nil {
-			encodeJson(w, http.StatusInternalServerError, err.Error())
+			writeError(w, http.StatusInternalServerError, err.Error())
 			return
 		}
 		encodeJson(w, http.StatusOK, category)
@@ -38,49 +42,116 @@ func (app *WebApp) GetCategories(w http.ResponseWriter, r *http.Request) {
 func (app *WebApp) NewComment(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 
 	var comment models.Comment
 
 	if err := decodeJson(r, &comment); err != nil {
-		encodeJson(w, http.StatusBadRequest, nil)
+		writeError(w, http.StatusBadRequest, "")
 		return
 	}
 
 	if err := models.ValidateComment(&comment); err != nil {
-		encodeJson(w, http.StatusBadRequest, nil)
+		writeValidationError(w, err)
+		return
+	}
+
+	post, err := app.Posts.GetPostByID(comment.PostID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if post.Deleted {
+		writeError(w, http.StatusGone, "this post was removed")
+		return
 	}
 
 	comment.UserID = user.ID
 
 	if err := app.Comments.InsertComment(comment); err != nil {
-		encodeJson(w, http.StatusInternalServerError, nil)
+		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
 
 	encodeJson(w, http.StatusOK, comment)
 }
 
+// DeleteComment soft deletes a comment, leaving a "[removed]" placeholder in
+// its thread; authors can delete their own, moderators anybody's. The body,
+// optional, gives a reason: {"reason": "spam"}.
+func (app *WebApp) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	commentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	removal, ok := decodeRemoval(w, r)
+	if !ok {
+		return
+	}
+
+	comment, err := app.Comments.GetComment(commentID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if comment.UserID != user.ID && !user.Can(models.PermModerate) {
+		writeError(w, http.StatusForbidden, "you are not allowed to do this")
+		return
+	}
+
+	if err := app.Comments.DeleteComment(commentID, user.ID, removal.Reason); err != nil {
+		writeRemovalError(w, err)
+		return
+	}
+	if comment.UserID != user.ID {
+		app.audit(r, comment.UserID, models.EventContentRemoved, models.LogWarning,
+			fmt.Sprintf("comment %d removed by %s (user %d): %q", commentID, user.UserName, user.ID, removal.Reason))
+	}
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
 func (app *WebApp) NewPost(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 
 	var post models.Post
 
-	decodeJson(r, &post)
+	if err := decodeJson(r, &post); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
 	post.UserID = user.ID
 
 	if err := models.ValidatePost(&post); err != nil {
-		encodeJson(w, http.StatusBadRequest, nil)
+		writeValidationError(w, err)
+		return
 	}
 
 	if err := app.Posts.InsertPost(post); err != nil {
-		encodeJson(w, http.StatusInternalServerError, nil)
+		writeError(w, http.StatusInternalServerError, "")
+		return
 	}
 
 	encodeJson(w, http.StatusOK, nil)
@@ -89,7 +160,7 @@ func (app *WebApp) NewPost(w http.ResponseWriter, r *http.Request) {
 func (app *WebApp) GetPosts(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 	var filter *models.PostFilter
@@ -105,12 +176,17 @@ func (app *WebApp) GetPosts(w http.ResponseWriter, r *http.Request) {
 }
 
 func (app *WebApp) GetPostComments(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
 	var filter *models.CommentsFilter
 	decodeJson(r, &filter)
 
-	comments, err := app.Comments.GetComments(filter)
+	comments, err := app.Comments.GetComments(filter, user.ID)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, nil)
+		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
 	encodeJson(w, http.StatusOK, comments)
@@ -119,15 +195,35 @@ func (app *WebApp) GetPostComments(w http.ResponseWriter, r *http.Request) {
 func (app *WebApp) Recent(w http.ResponseWriter, r *http.Request) {
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 
 	users, err := app.Users.GetSortedUsersByConversation(user.ID)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+
+	blocked, err := app.Blocks.BlockedEitherWay(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	hidden, err := app.Settings.HiddenPresence()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	for i := range users {
+		// blocked users don't get to know when the other is around, nor
+		// anybody when the user chose not to show it
+		if blocked[users[i].ID] || hidden[users[i].ID] {
+			users[i].LastSeenAt = nil
+			continue
+		}
+		users[i].IsOnline = app.Hub.IsOnline(users[i].ID)
+	}
 	encodeJson(w, http.StatusOK, users)
 }
 
@@ -137,12 +233,12 @@ func (app *WebApp) Conversation(w http.ResponseWriter, r *http.Request) {
 
 	user, ok := r.Context().Value(contextKeyUser).(*models.User)
 	if !ok || !filter.ConversationID.Valid {
-		encodeJson(w, http.StatusUnauthorized, nil)
+		writeError(w, http.StatusUnauthorized, "")
 		return
 	}
 	chunkedMessages, err := app.Messages.GetMessages(user.ID, filter)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, err.Error())
+		writeError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 	encodeJson(w, http.StatusOK, chunkedMessages)
@@ -152,7 +248,7 @@ func (app *WebApp) MarkSeen(w http.ResponseWriter, r *http.Request) {
 
 	var mark models.MessagesFilter
 	if err := decodeJson(r, &mark); err != nil {
-		encodeJson(w, http.StatusBadRequest, nil)
+		writeError(w, http.StatusBadRequest, "")
 		return
 	}
 
@@ -161,7 +257,7 @@ func (app *WebApp) MarkSeen(w http.ResponseWriter, r *http.Request) {
 		UPDATE messages SET seen_at = ? 
 		WHERE conversation_id = ?`, now, mark.ConversationID)
 	if err != nil {
-		encodeJson(w, http.StatusInternalServerError, nil)
+		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
 	encodeJson(w, http.StatusOK, nil)
@@ -1,7 +1,7 @@
 package handlers
 
 import (
-	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"sync"
@@ -15,10 +15,19 @@ import (
 type WSHub struct {
 	Upgrader  websocket.Upgrader
 	Clients   map[*websocket.Conn]*models.User
+	Online    map[int]int // open connections per user ID
 	Broadcast chan models.Message
 	Lock      sync.Mutex
 }
 
+// send writes to one client under the hub lock, like BroadcastMessages does:
+// gorilla/websocket allows only one writer per connection at a time
+func (hub *WSHub) send(conn *websocket.Conn, v any) error {
+	hub.Lock.Lock()
+	defer hub.Lock.Unlock()
+	return conn.WriteJSON(v)
+}
+
 func (app *WebApp) HTTPtoWS(w http.ResponseWriter, r *http.Request) {
 	wsConn, err := app.Hub.Upgrader.Upgrade(w, r, nil)
 	if err != nil {
@@ -36,15 +45,28 @@ func (app *WebApp) HTTPtoWS(w http.ResponseWriter, r *http.Request) {
 
 	app.Hub.Lock.Lock()
 	app.Hub.Clients[wsConn] = user
+	app.Hub.Online[user.ID]++
+	first := app.Hub.Online[user.ID] == 1
 	app.Hub.Lock.Unlock()
 
 	log.Printf("✅ WebSocket connected: User ID %d\n", user.ID)
+	if first {
+		app.setPresence(user.ID, true)
+	}
 
 	defer func() {
 		app.Hub.Lock.Lock()
 		delete(app.Hub.Clients, wsConn)
+		app.Hub.Online[user.ID]--
+		last := app.Hub.Online[user.ID] == 0
+		if last {
+			delete(app.Hub.Online, user.ID)
+		}
 		app.Hub.Lock.Unlock()
 		log.Printf("❌ WebSocket disconnected: User ID %d\n", user.ID)
+		if last {
+			app.setPresence(user.ID, false)
+		}
 	}()
 
 	for {
@@ -84,8 +106,8 @@ func (app *WebApp) BroadcastMessages() {
 				// Send to receiver only (not back to sender)
 				shouldSend = user.ID == msg.RecieverID
 			case "typing":
-				// Send typing indicators to all participants except sender
-				shouldSend = user.ID != msg.AuthorID 
+				// Send typing indicators to the other participant only
+				shouldSend = user.ID == msg.RecieverID
 			}
 
 			if shouldSend {
@@ -104,6 +126,25 @@ func (app *WebApp) BroadcastMessages() {
 }
 
 func (app *WebApp) handleChatMessage(wsConn *websocket.Conn, user *models.User, message *models.Message) error {
+	// Refuse messages the receiver doesn't accept
+	if err := app.checkChat(user.ID, message.RecieverID); err != nil {
+		if !isChatRefusal(err) {
+			log.Println("❌ Error checking blocks and settings:", err)
+			return err
+		}
+		log.Printf("🚫 Message from %d to %d refused: %v\n", user.ID, message.RecieverID, err)
+		refusal := models.Message{
+			Type:       "error",
+			RecieverID: message.RecieverID,
+			TempID:     message.TempID,
+			Content:    err.Error(),
+		}
+		if err := app.Hub.send(wsConn, refusal); err != nil {
+			log.Printf("❌ Failed to send refusal to user %d: %v", user.ID, err)
+		}
+		return nil
+	}
+
 	// Get or create conversation
 	conv, err := app.Conversations.GetConversation(user.ID, message.RecieverID)
 	if err != nil {
@@ -139,15 +180,12 @@ func (app *WebApp) handleChatMessage(wsConn *websocket.Conn, user *models.User,
 
 	// Send ACK to sender
 	ack := models.Message{
-		Type:    "ack",
-		ConversationID: sql.NullInt64{
-			Int64: int64(conv.ID),
-			Valid: true,
-		},
-		TempID:  message.TempID,
-		Content: "Message delivered",
-	}
-	if err := wsConn.WriteJSON(ack); err != nil {
+		Type:           "ack",
+		ConversationID: message.ConversationID,
+		TempID:         message.TempID,
+		Content:        "Message delivered",
+	}
+	if err := app.Hub.send(wsConn, ack); err != nil {
 		log.Printf("❌ Failed to send ACK to user %d: %v", user.ID, err)
 	}
 
@@ -162,17 +200,50 @@ func (app *WebApp) handleChatMessage(wsConn *websocket.Conn, user *models.User,
 	broadcastMessage.Type = "message" // Ensure type is set for broadcast
 
 	log.Printf("📤 Broadcasting message: %+v\n", broadcastMessage)
-	 wsConn.WriteJSON(ack)
 	app.Hub.Broadcast <- broadcastMessage
 
 	return nil
 }
 
 func (app *WebApp) handleTypingMessage(user *models.User, message *models.Message) {
-	// Forward typing indicator to other participants
+	// Find who the indicator is for: the other participant of the
+	// conversation, or the receiver when there's no conversation yet
+	receiverID := message.RecieverID
+	if message.ConversationID.Valid {
+		conv, err := app.Conversations.GetConversationByID(message.ConversationID.Int64)
+		if err != nil {
+			log.Println("❌ Error fetching conversation:", err)
+			return
+		}
+		switch {
+		case conv == nil:
+			return
+		case conv.User1ID == user.ID:
+			receiverID = conv.User2ID
+		case conv.User2ID == user.ID:
+			receiverID = conv.User1ID
+		default:
+			log.Printf("⚠️ User %d is not in conversation %d\n", user.ID, conv.ID)
+			return
+		}
+	}
+	if receiverID == 0 || receiverID == user.ID {
+		return
+	}
+
+	// Drop it if the receiver wouldn't accept a message or muted the sender
+	if err := app.checkChat(user.ID, receiverID); err != nil {
+		return
+	}
+	if hidden, err := app.Blocks.Hides(receiverID, user.ID); err != nil || hidden {
+		return
+	}
+
+	// Forward typing indicator to the other participant
 	typingMessage := models.Message{
 		Type:           "typing",
 		AuthorID:       user.ID,
+		RecieverID:     receiverID,
 		ConversationID: message.ConversationID,
 		SentAt:         time.Now(),
 	}
@@ -181,4 +252,22 @@ func (app *WebApp) handleTypingMessage(user *models.User, message *models.Messag
 	app.Hub.Broadcast <- typingMessage
 }
 
+// checkChat tells whether senderID may message receiverID: neither blocked
+// the other and the receiver's dm_policy lets the sender in
+func (app *WebApp) checkChat(senderID, receiverID int) error {
+	if err := app.Blocks.CheckChat(senderID, receiverID); err != nil {
+		return err
+	}
+	return app.Settings.CheckDM(senderID, receiverID)
+}
 
+// isChatRefusal tells the errors of checkChat the sender is shown apart
+// from failures
+func isChatRefusal(err error) bool {
+	for _, refusal := range []error{models.ErrBlockedUser, models.ErrBlockedByUser, models.ErrDMsClosed, models.ErrDMsFollowingOnly} {
+		if errors.Is(err, refusal) {
+			return true
+		}
+	}
+	return false
+}
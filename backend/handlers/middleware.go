@@ -2,22 +2,42 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
 	"slices"
 	"strings"
+
+	"echohub/models"
 )
 
 type contextKey string
 
-const contextKeyUser = contextKey("Context_key_User")
+const (
+	contextKeyUser     = contextKey("Context_key_User")
+	contextKeySession  = contextKey("Context_key_Session")
+	contextKeyAPIToken = contextKey("Context_key_APIToken")
+)
 
 var publicRoutes = []string{
 	"/",
 	"/signup",
 	"/signin",
+	"/signin/2fa",
+	"/refresh",
+	"/password/forgot",
+	"/password/reset",
+	"/verify-email",
+	"/policy",
 	"/public/",
 }
 
+// routes closed to users who haven't verified their email yet
+var verifiedRoutes = []string{
+	"/newpost",
+	"/newcomment",
+	"/ws",
+}
+
 func isPublicPath(path string) bool {
 	if slices.Contains(publicRoutes, path) || strings.HasPrefix(path, "/public/") {
 		return true
@@ -31,24 +51,105 @@ func (App *WebApp) AuthMiddleware(next http.Handler) http.Handler {
 			next.ServeHTTP(w, r)
 			return
 		}
+		if bearer, ok := bearerToken(r); ok {
+			App.authenticateAPIToken(w, r, next, bearer)
+			return
+		}
 		cookie, err := r.Cookie("session_id")
 		if err != nil {
-			w.WriteHeader(http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, "")
 			return
 		}
 		session, errCode, err := App.Sessions.GetUserBySession(cookie.Value)
 		if err != nil {
-			w.WriteHeader(errCode)
+			writeError(w, errCode, "")
 			return
 		}
 		user, err := App.Users.GetUserByID(session.UserID)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, "")
+			return
+		}
+		if !user.EmailVerified && slices.Contains(verifiedRoutes, r.URL.Path) {
+			writeError(w, http.StatusForbidden, "email address not verified")
+			return
+		}
+		renewed, err := App.Sessions.TouchSession(&session, clientIP(r))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "")
 			return
 		}
+		if renewed {
+			cookie := models.SessionCookie(session)
+			http.SetCookie(w, &cookie)
+		}
 		// log.Println("auth", contextKeyUser, user)
 
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
+		ctx = context.WithValue(ctx, contextKeySession, &session)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// bearerToken extracts the token of an "Authorization: Bearer" header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// authenticateAPIToken is the AuthMiddleware path for personal API tokens
+func (App *WebApp) authenticateAPIToken(w http.ResponseWriter, r *http.Request, next http.Handler, bearer string) {
+	token, err := App.APITokens.Authenticate(bearer)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidAPIToken) {
+			writeError(w, http.StatusUnauthorized, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	user, err := App.Users.GetUserByID(token.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if !user.EmailVerified && slices.Contains(verifiedRoutes, r.URL.Path) {
+		writeError(w, http.StatusForbidden, "email address not verified")
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), contextKeyUser, user)
+	ctx = context.WithValue(ctx, contextKeyAPIToken, &token)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Require lets the request through only if the signed in user's role grants
+// permission. Requests authenticated with an API token also need the matching scope.
+func (App *WebApp) Require(permission models.Permission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, ok := r.Context().Value(contextKeyUser).(*models.User)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "")
+			return
+		}
+
+		if token, ok := r.Context().Value(contextKeyAPIToken).(*models.APIToken); ok {
+			scope := permission.TokenScope()
+			if scope == "" || !token.HasScope(scope) {
+				writeError(w, http.StatusForbidden, "api token is missing the required scope")
+				return
+			}
+		}
+
+		if !user.Can(permission) {
+			writeError(w, http.StatusForbidden, "you are not allowed to do this")
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+
+	"echohub/mailer"
+	"echohub/models"
+)
+
+// ForgotPassword emails a reset link when the address belongs to an account.
+// It answers the same way either way so emails can't be enumerated.
+func (App *WebApp) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var request models.PasswordReset
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	user, err := App.Users.GetUserByEmail(request.Email)
+	if err != nil {
+		encodeJson(w, http.StatusAccepted, nil)
+		return
+	}
+
+	token, err := App.PasswordResets.CreateResetToken(user.ID)
+	if err != nil {
+		log.Println("❌ Failed to create reset token:", err)
+		encodeJson(w, http.StatusAccepted, nil)
+		return
+	}
+
+	link := App.BaseURL + "/password/reset?token=" + url.QueryEscape(token)
+	go func() {
+		err := App.Mailer.Send(mailer.Mail{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: "Hi " + user.FirstName + ",\n\n" +
+				"Someone asked to reset the password of your account. If it was you, open the link below " +
+				"within the next hour to choose a new one:\n\n" + link + "\n\n" +
+				"If you didn't ask for this, you can ignore this email.",
+		})
+		if err != nil {
+			log.Println("❌ Failed to send reset mail:", err)
+		}
+	}()
+
+	encodeJson(w, http.StatusAccepted, nil)
+}
+
+// ResetPassword sets a new password from a reset token, signs the user out
+// everywhere and revokes their API tokens
+func (App *WebApp) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var request models.PasswordReset
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := App.Users.ValidatePassword(request.Password, request.RepeatedPass); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	userID, err := App.Users.ResetPassword(request.Token, request.Password)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidResetToken) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Sessions.DeleteUserSessions(userID, 0); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	App.audit(r, userID, models.EventPasswordChanged, models.LogInfo, "password reset with an emailed link, all sessions and api tokens revoked")
+
+	encodeJson(w, http.StatusOK, nil)
+}
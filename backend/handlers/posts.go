@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"echohub/models"
+)
+
+// EditPost lets the author change the title, content and categories of a
+// post. The body carries the version of the post the client loaded; the
+// edit is refused with 409 Conflict if the post changed since.
+func (App *WebApp) EditPost(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	var post models.Post
+	if err := decodeJson(r, &post); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	expected := post.Version
+	post.ID = postID
+
+	current, err := App.Posts.GetPostByID(postID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if current.UserID != user.ID {
+		writeError(w, http.StatusForbidden, "only the author can edit a post")
+		return
+	}
+	if current.Deleted {
+		writeError(w, http.StatusGone, "this post was removed")
+		return
+	}
+	post.UserID = current.UserID
+
+	if err := models.ValidatePost(&post); err != nil {
+		writeValidationError(w, err)
+		return
+	}
+	if expected < 1 {
+		writeValidationError(w, &models.ValidationError{Fields: map[string]string{"version": "version of the post being edited is required"}})
+		return
+	}
+
+	updated, err := App.Posts.UpdatePost(post, expected, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEditConflict):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "")
+		default:
+			writeError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	encodeJson(w, http.StatusOK, updated)
+}
+
+// GetPostRevisions lists every version of a post, oldest first
+func (App *WebApp) GetPostRevisions(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	revisions, ok := App.postRevisions(w, r, postID)
+	if !ok {
+		return
+	}
+	encodeJson(w, http.StatusOK, revisions)
+}
+
+// DiffPostRevisions compares two versions of a post word by word. Query
+// parameters: from (the previous version by default) and to (the latest).
+func (App *WebApp) DiffPostRevisions(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	revisions, ok := App.postRevisions(w, r, postID)
+	if !ok {
+		return
+	}
+
+	latest := revisions[len(revisions)-1].Version
+	query := r.URL.Query()
+	invalid := map[string]string{}
+	to := queryInt(query, "to", latest, 1, latest, invalid)
+	from := queryInt(query, "from", max(to-1, 1), 1, latest, invalid)
+	if len(invalid) > 0 {
+		writeValidationError(w, &models.ValidationError{Fields: invalid})
+		return
+	}
+
+	var fromRevision, toRevision *models.PostRevision
+	for i := range revisions {
+		switch revisions[i].Version {
+		case from:
+			fromRevision = &revisions[i]
+		case to:
+			toRevision = &revisions[i]
+		}
+	}
+	if from == to {
+		fromRevision = toRevision
+	}
+	if fromRevision == nil || toRevision == nil {
+		writeError(w, http.StatusNotFound, "no such revision")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, models.DiffRevisions(*fromRevision, *toRevision))
+}
+
+// postRevisions loads the revisions of a post, replying 404 when there is
+// no such post or it was removed, unless the caller is a moderator
+func (App *WebApp) postRevisions(w http.ResponseWriter, r *http.Request, postID int) ([]models.PostRevision, bool) {
+	post, err := App.Posts.GetPostByID(postID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return nil, false
+	}
+	if post.Deleted {
+		user, ok := r.Context().Value(contextKeyUser).(*models.User)
+		if !ok || !user.Can(models.PermModerate) {
+			writeError(w, http.StatusNotFound, "")
+			return nil, false
+		}
+	}
+
+	revisions, err := App.Posts.GetRevisions(postID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return nil, false
+	}
+	if len(revisions) == 0 {
+		// posts from before revisions were kept only have their current version
+		revision := models.PostRevision{
+			Version:     post.Version,
+			Title:       post.Title,
+			Content:     post.Content,
+			CategoryIDs: []int{},
+			EditorID:    &post.UserID,
+			Editor:      post.Username,
+			CreatedAt:   post.CreatedAt,
+		}
+		for _, cat := range post.Categories {
+			revision.CategoryIDs = append(revision.CategoryIDs, cat.ID)
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, true
+}
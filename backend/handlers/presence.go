@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log"
+	"time"
+)
+
+// Presence is the WebSocket event telling that a user came online (their
+// first connection opened) or went offline (their last one closed)
+type Presence struct {
+	Type       string    `json:"type"` // always "presence"
+	UserID     int       `json:"user_id"`
+	Online     bool      `json:"online"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+}
+
+// IsOnline reports whether the user has a chat connection open
+func (hub *WSHub) IsOnline(userID int) bool {
+	hub.Lock.Lock()
+	defer hub.Lock.Unlock()
+	return hub.Online[userID] > 0
+}
+
+// setPresence records the user's last seen time and, unless their settings
+// hide it, tells everybody else connected
+func (app *WebApp) setPresence(userID int, online bool) {
+	now := time.Now()
+	if err := app.Users.UpdateLastSeen(userID, now); err != nil {
+		log.Printf("❌ Failed to update last seen of user %d: %v", userID, err)
+	}
+
+	settings, err := app.Settings.GetSettings(userID)
+	if err != nil {
+		log.Printf("❌ Failed to load settings of user %d: %v", userID, err)
+		return
+	}
+	if settings.ShowOnline {
+		app.broadcastPresence(userID, online, now)
+	}
+}
+
+// broadcastPresence sends a presence event to everybody connected but the
+// user and users on either side of a block with them
+func (app *WebApp) broadcastPresence(userID int, online bool, lastSeenAt time.Time) {
+	blocked, err := app.Blocks.BlockedEitherWay(userID)
+	if err != nil {
+		log.Printf("❌ Failed to load blocks of user %d: %v", userID, err)
+		return
+	}
+
+	event := Presence{Type: "presence", UserID: userID, Online: online, LastSeenAt: lastSeenAt}
+
+	app.Hub.Lock.Lock()
+	defer app.Hub.Lock.Unlock()
+	for client, user := range app.Hub.Clients {
+		if user.ID == userID || blocked[user.ID] {
+			continue
+		}
+		if err := client.WriteJSON(event); err != nil {
+			log.Printf("❌ Write error to user %d: %v\n", user.ID, err)
+			client.Close()
+			delete(app.Hub.Clients, client)
+		}
+	}
+}
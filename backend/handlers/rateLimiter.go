@@ -41,15 +41,18 @@ func NewRateLimiter(limit int, duration time.Duration) *RateLimiter {
 }
 
 func (rl *RateLimiter) Allow(r *http.Request) bool {
-	ip := r.RemoteAddr
+	return rl.AllowKey(r.RemoteAddr)
+}
 
+// AllowKey applies the limit to an arbitrary key (user ID, email...) instead of the client address
+func (rl *RateLimiter) AllowKey(key string) bool {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 	now := time.Now()
 
-	client, exists := rl.users[ip]
+	client, exists := rl.users[key]
 	if !exists || now.After(client.resetTime) {
-		rl.users[ip] = &clientData{
+		rl.users[key] = &clientData{
 			count:     1,
 			resetTime: now.Add(rl.duration),
 		}
@@ -65,7 +68,7 @@ func (rl *RateLimiter) Allow(r *http.Request) bool {
 func (rl *RateLimiter) RLMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !rl.Allow(r) {
-			encodeJson(w, http.StatusTooManyRequests, nil)
+			writeError(w, http.StatusTooManyRequests, "")
 			return
 		}
 		next.ServeHTTP(w, r)
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"echohub/models"
+)
+
+// DeletePost soft deletes a post: it stays in the feed as a "[removed]"
+// placeholder. Authors can delete their own, moderators anybody's. The
+// body, optional, gives a reason: {"reason": "spam"}.
+func (App *WebApp) DeletePost(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+	removal, ok := decodeRemoval(w, r)
+	if !ok {
+		return
+	}
+
+	post, err := App.Posts.GetPostByID(postID)
+	if err != nil {
+		writeRemovalError(w, err)
+		return
+	}
+	if post.UserID != user.ID && !user.Can(models.PermModerate) {
+		writeError(w, http.StatusForbidden, "you are not allowed to do this")
+		return
+	}
+
+	if err := App.Posts.DeletePost(postID, user.ID, removal.Reason); err != nil {
+		writeRemovalError(w, err)
+		return
+	}
+	if post.UserID != user.ID {
+		App.audit(r, post.UserID, models.EventContentRemoved, models.LogWarning,
+			fmt.Sprintf("post %d removed by %s (user %d): %q", postID, user.UserName, user.ID, removal.Reason))
+	}
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// RestorePost brings back a removed post
+func (App *WebApp) RestorePost(w http.ResponseWriter, r *http.Request) {
+	App.moderate(w, r, "post", models.EventContentRestored, "restored", App.postAuthor, App.Posts.RestorePost)
+}
+
+// PurgePost deletes a removed post for good, with its comments
+func (App *WebApp) PurgePost(w http.ResponseWriter, r *http.Request) {
+	App.moderate(w, r, "post", models.EventContentPurged, "purged", App.postAuthor, App.Posts.PurgePost)
+}
+
+// RestoreComment brings back a removed comment
+func (App *WebApp) RestoreComment(w http.ResponseWriter, r *http.Request) {
+	App.moderate(w, r, "comment", models.EventContentRestored, "restored", App.commentAuthor, App.Comments.RestoreComment)
+}
+
+// PurgeComment deletes a removed comment for good
+func (App *WebApp) PurgeComment(w http.ResponseWriter, r *http.Request) {
+	App.moderate(w, r, "comment", models.EventContentPurged, "purged", App.commentAuthor, App.Comments.PurgeComment)
+}
+
+// moderate runs a moderator action on the post or comment of the path's
+// id and records it in the audit log of its author
+func (App *WebApp) moderate(w http.ResponseWriter, r *http.Request, kind, event, verb string,
+	authorOf func(id int) (int, error), action func(id int) error) {
+	moderator, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	authorID, err := authorOf(id)
+	if err != nil {
+		writeRemovalError(w, err)
+		return
+	}
+	if err := action(id); err != nil {
+		writeRemovalError(w, err)
+		return
+	}
+	App.audit(r, authorID, event, models.LogWarning,
+		fmt.Sprintf("%s %d %s by %s (user %d)", kind, id, verb, moderator.UserName, moderator.ID))
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+func (App *WebApp) postAuthor(id int) (int, error) {
+	post, err := App.Posts.GetPostByID(id)
+	return post.UserID, err
+}
+
+func (App *WebApp) commentAuthor(id int) (int, error) {
+	comment, err := App.Comments.GetComment(id)
+	return comment.UserID, err
+}
+
+// decodeRemoval reads the optional reason of a deletion, replying 400 on
+// a malformed body
+func decodeRemoval(w http.ResponseWriter, r *http.Request) (models.Removal, bool) {
+	var removal models.Removal
+	if err := decodeJson(r, &removal); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "")
+		return removal, false
+	}
+	if err := models.ValidateRemoval(&removal); err != nil {
+		writeValidationError(w, err)
+		return removal, false
+	}
+	return removal, true
+}
+
+func writeRemovalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "")
+	case errors.Is(err, models.ErrAlreadyRemoved), errors.Is(err, models.ErrNotRemoved):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "")
+	}
+}
@@ -3,19 +3,33 @@ package handlers
 import (
 	"net/http"
 
+	"echohub/mailer"
 	"echohub/models"
 )
 
 type WebApp struct {
-	Users         *models.UserModel
-	Categories    *models.CategoryModel
-	Posts         *models.PostModel
-	Comments      *models.CommentModel
-	Conversations *models.ConversationModel
-	Messages      *models.MessageModel
-	Sessions      *models.SessionModel
-	Hub WSHub
-	Rl  *RateLimiter
+	Users          *models.UserModel
+	Categories     *models.CategoryModel
+	Posts          *models.PostModel
+	Comments       *models.CommentModel
+	Conversations  *models.ConversationModel
+	Messages       *models.MessageModel
+	Sessions       *models.SessionModel
+	PasswordResets *models.PasswordResetModel
+	LoginAttempts  *models.LoginAttemptModel
+	Logs           *models.LogModel
+	APITokens      *models.APITokenModel
+	Exports        *models.ExportJobModel
+	Follows        *models.FollowModel
+	Blocks         *models.BlockModel
+	Settings       *models.SettingsModel
+	Hub            WSHub
+	Rl             *RateLimiter
+	Origins        *OriginGuard
+	ResendRl       *RateLimiter // throttles verification mail resends per user
+	Mailer         mailer.Mailer
+	BaseURL        string // public URL of the app, used in emailed links
+	Secret         []byte // signs verification links
 }
 
 func (app *WebApp) NewRouter() http.Handler {
@@ -27,24 +41,87 @@ func (app *WebApp) NewRouter() http.Handler {
 
 	// Serve the HTML file on root
 	mux.HandleFunc("/", app.Home)
+
+	// public routes (see publicRoutes in middleware.go)
 	mux.HandleFunc("POST /signup", app.SignUp)
 	mux.HandleFunc("POST /signin", app.SignIn)
-	mux.HandleFunc("DELETE /signout", app.SignOut)
-	mux.HandleFunc("POST /me", app.LoggedUser)
+	mux.HandleFunc("POST /signin/2fa", app.SignInTwoFactor)
+	mux.HandleFunc("POST /refresh", app.Refresh)
+	mux.HandleFunc("POST /password/forgot", app.ForgotPassword)
+	mux.HandleFunc("POST /password/reset", app.ResetPassword)
+	mux.HandleFunc("POST /verify-email", app.VerifyEmail)
+	mux.HandleFunc("GET /policy", app.GetPolicy)
+
+	// account
+	app.handle(mux, "DELETE /signout", models.PermAccount, app.SignOut)
+	app.handle(mux, "POST /verify-email/resend", models.PermAccount, app.ResendVerification)
+	app.handle(mux, "POST /me", models.PermRead, app.LoggedUser)
+	app.handle(mux, "PATCH /me", models.PermAccount, app.UpdateProfile)
+	app.handle(mux, "DELETE /me", models.PermAccount, app.DeleteAccount)
+	app.handle(mux, "POST /me/password", models.PermAccount, app.ChangePassword)
+	app.handle(mux, "POST /me/avatar", models.PermAccount, app.UploadAvatar)
+	app.handle(mux, "GET /me/export", models.PermAccount, app.ExportData)
+	app.handle(mux, "GET /me/export/{id}", models.PermAccount, app.GetExport)
+	app.handle(mux, "GET /me/settings", models.PermAccount, app.GetSettings)
+	app.handle(mux, "PATCH /me/settings", models.PermAccount, app.UpdateSettings)
+	app.handle(mux, "GET /me/blocks", models.PermAccount, app.ListBlocks)
+	app.handle(mux, "GET /me/mutes", models.PermAccount, app.ListMutes)
+	app.handle(mux, "GET /sessions", models.PermAccount, app.ListSessions)
+	app.handle(mux, "DELETE /sessions/{id}", models.PermAccount, app.RevokeSession)
+	app.handle(mux, "DELETE /sessions", models.PermAccount, app.RevokeAllSessions)
+	app.handle(mux, "GET /tokens", models.PermAccount, app.ListAPITokens)
+	app.handle(mux, "POST /tokens", models.PermAccount, app.CreateAPIToken)
+	app.handle(mux, "DELETE /tokens/{id}", models.PermAccount, app.RevokeAPIToken)
+	app.handle(mux, "POST /2fa/enroll", models.PermAccount, app.EnrollTOTP)
+	app.handle(mux, "POST /2fa/confirm", models.PermAccount, app.ConfirmTOTP)
+	app.handle(mux, "POST /2fa/disable", models.PermAccount, app.DisableTOTP)
+	app.handle(mux, "POST /2fa/recovery-codes", models.PermAccount, app.RegenerateRecoveryCodes)
 	// mux.HandleFunc("/auth", app.Auth)
 
+	// forum
+	app.handle(mux, "POST /categories", models.PermRead, app.GetCategories)
+	app.handle(mux, "POST /newpost", models.PermPost, app.NewPost)
+	app.handle(mux, "POST /posts", models.PermRead, app.GetPosts)
+	app.handle(mux, "PATCH /posts/{id}", models.PermPost, app.EditPost)
+	app.handle(mux, "DELETE /posts/{id}", models.PermPost, app.DeletePost)
+	app.handle(mux, "GET /posts/{id}/revisions", models.PermRead, app.GetPostRevisions)
+	app.handle(mux, "GET /posts/{id}/revisions/diff", models.PermRead, app.DiffPostRevisions)
+	app.handle(mux, "POST /comments", models.PermRead, app.GetPostComments)
+	app.handle(mux, "POST /newcomment", models.PermComment, app.NewComment) // TODO to implement
+	app.handle(mux, "DELETE /comments/{id}", models.PermComment, app.DeleteComment)
+	app.handle(mux, "POST /posts/{id}/restore", models.PermModerate, app.RestorePost)
+	app.handle(mux, "POST /posts/{id}/purge", models.PermModerate, app.PurgePost)
+	app.handle(mux, "POST /comments/{id}/restore", models.PermModerate, app.RestoreComment)
+	app.handle(mux, "POST /comments/{id}/purge", models.PermModerate, app.PurgeComment)
+	app.handle(mux, "GET /users", models.PermRead, app.SearchUsers)
+	app.handle(mux, "GET /users/{username}", models.PermRead, app.GetProfile)
+	app.handle(mux, "POST /users/{username}/follow", models.PermAccount, app.Follow)
+	app.handle(mux, "DELETE /users/{username}/follow", models.PermAccount, app.Unfollow)
+	app.handle(mux, "GET /users/{username}/followers", models.PermRead, app.GetFollowers)
+	app.handle(mux, "GET /users/{username}/following", models.PermRead, app.GetFollowing)
+	app.handle(mux, "POST /users/{username}/block", models.PermAccount, app.Block)
+	app.handle(mux, "DELETE /users/{username}/block", models.PermAccount, app.Unblock)
+	app.handle(mux, "POST /users/{username}/mute", models.PermAccount, app.Mute)
+	app.handle(mux, "DELETE /users/{username}/mute", models.PermAccount, app.Unmute)
 
-	mux.HandleFunc("POST /categories", app.GetCategories)
-	mux.HandleFunc("POST /newpost", app.NewPost)
-	mux.HandleFunc("POST /posts", app.GetPosts)
-	mux.HandleFunc("POST /comments", app.GetPostComments)
-	mux.HandleFunc("POST /newcomment", app.NewComment) // TODO to implement
-	mux.HandleFunc("/ws", app.HTTPtoWS)
-	mux.HandleFunc("POST /recent", app.Recent)
-	mux.HandleFunc("POST /conversation", app.Conversation)
-	mux.HandleFunc("POST /mark-seen", app.MarkSeen)
+	// chat
+	app.handle(mux, "/ws", models.PermChat, app.HTTPtoWS)
+	app.handle(mux, "POST /recent", models.PermChat, app.Recent)
+	app.handle(mux, "POST /conversation", models.PermChat, app.Conversation)
+	app.handle(mux, "POST /mark-seen", models.PermChat, app.MarkSeen)
 
+	// administration
+	app.handle(mux, "POST /categories/new", models.PermManageCategories, app.CreateCategory)
+	app.handle(mux, "PATCH /categories/{id}", models.PermManageCategories, app.UpdateCategory)
+	app.handle(mux, "DELETE /categories/{id}", models.PermManageCategories, app.DeleteCategory)
+	app.handle(mux, "PATCH /users/{id}/role", models.PermManageRoles, app.SetUserRole)
+	app.handle(mux, "GET /admin/logs", models.PermViewAuditLog, app.ListAuditLogs)
 
 	// return app.Rl.RLMiddleware((mux))
-	return app.Rl.RLMiddleware(app.AuthMiddleware(mux))
+	return app.Rl.RLMiddleware(app.Origins.Middleware(app.AuthMiddleware(mux)))
+}
+
+// handle registers an authenticated route together with the permission it requires
+func (app *WebApp) handle(mux *http.ServeMux, pattern string, permission models.Permission, handler http.HandlerFunc) {
+	mux.HandleFunc(pattern, app.Require(permission, handler))
 }
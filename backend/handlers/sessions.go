@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"echohub/models"
+)
+
+// ListSessions returns every device the user is signed in on
+func (App *WebApp) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	current, okSession := r.Context().Value(contextKeySession).(*models.Session)
+	if !ok || !okSession {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	sessions, err := App.Sessions.GetUserSessions(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == current.ID
+	}
+
+	encodeJson(w, http.StatusOK, sessions)
+}
+
+// RevokeSession signs the user out of a single device
+func (App *WebApp) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := App.Sessions.DeleteUserSession(user.ID, sessionID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	App.audit(r, user.ID, models.EventSessionRevoked, models.LogInfo, fmt.Sprintf("session %d revoked", sessionID))
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// RevokeAllSessions signs the user out of every device except the current one
+func (App *WebApp) RevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	current, okSession := r.Context().Value(contextKeySession).(*models.Session)
+	if !ok || !okSession {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	if err := App.Sessions.DeleteUserSessions(user.ID, current.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	App.audit(r, user.ID, models.EventSessionRevoked, models.LogInfo, fmt.Sprintf("all sessions but %d revoked", current.ID))
+
+	encodeJson(w, http.StatusOK, nil)
+}
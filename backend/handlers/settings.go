@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"echohub/models"
+)
+
+// GetSettings returns the signed in user's preferences and privacy settings
+func (App *WebApp) GetSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	settings, err := App.Settings.GetSettings(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	encodeJson(w, http.StatusOK, settings)
+}
+
+// UpdateSettings changes the settings present in the request body and
+// returns all of them
+func (App *WebApp) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	patch, err := io.ReadAll(io.LimitReader(r.Body, 1<<16))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	previous, err := App.Settings.GetSettings(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	settings, err := App.Settings.UpdateSettings(user.ID, patch)
+	if err != nil {
+		writeValidationError(w, err)
+		return
+	}
+
+	// showing or hiding one's status while connected looks like coming
+	// online or going offline to the others
+	if settings.ShowOnline != previous.ShowOnline && App.Hub.IsOnline(user.ID) {
+		App.broadcastPresence(user.ID, settings.ShowOnline, time.Now())
+	}
+
+	encodeJson(w, http.StatusOK, settings)
+}
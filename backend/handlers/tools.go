@@ -4,8 +4,15 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"echohub/models"
 )
 
 func decodeJson(r *http.Request, obj interface{}) error {
@@ -37,7 +44,7 @@ func encodeJson(w http.ResponseWriter, statusCode int, obj interface{}) error {
 	encoder.SetIndent("", "  ")
 
 	if err := encoder.Encode(obj); err != nil {
-		http.Error(w, `{"error":"failed to encode response"}`, http.StatusInternalServerError)
+		http.Error(w, `{"error":{"code":"internal_server_error","message":"failed to encode response"}}`, http.StatusInternalServerError)
 		return err
 	}
 
@@ -46,3 +53,64 @@ func encodeJson(w http.ResponseWriter, statusCode int, obj interface{}) error {
 	_, err := w.Write(buffer.Bytes())
 	return err
 }
+
+// apiError is the body of every error response, as {"error": {...}}
+type apiError struct {
+	Code    string            `json:"code"`
+	Message string            `json:"message"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// writeError replies with the error envelope. The code is derived from the
+// status ("not_found", ...) and an empty message defaults to the status text.
+func writeError(w http.ResponseWriter, statusCode int, message string) error {
+	return writeAPIError(w, statusCode, apiError{Message: message})
+}
+
+// writeValidationError replies 400 with the invalid fields of a
+// *models.ValidationError. Anything else is a server side failure.
+func writeValidationError(w http.ResponseWriter, err error) error {
+	var invalid *models.ValidationError
+	if !errors.As(err, &invalid) {
+		return writeError(w, http.StatusInternalServerError, "")
+	}
+	return writeAPIError(w, http.StatusBadRequest, apiError{
+		Code:    "validation_failed",
+		Message: "some fields are invalid",
+		Fields:  invalid.Fields,
+	})
+}
+
+func writeAPIError(w http.ResponseWriter, statusCode int, body apiError) error {
+	if body.Code == "" {
+		body.Code = strings.ReplaceAll(strings.ToLower(http.StatusText(statusCode)), " ", "_")
+	}
+	if body.Message == "" {
+		body.Message = strings.ToLower(http.StatusText(statusCode))
+	}
+	return encodeJson(w, statusCode, map[string]apiError{"error": body})
+}
+
+// queryInt reads an optional number from the query string, recording an
+// error in invalid when it's not between min and max
+func queryInt(query url.Values, name string, fallback, min, max int, invalid map[string]string) int {
+	value := query.Get(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		invalid[name] = fmt.Sprintf("%s must be a number between %d and %d", name, min, max)
+		return fallback
+	}
+	return n
+}
+
+// clientIP returns the remote address of the request without its port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
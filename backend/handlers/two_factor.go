@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"echohub/models"
+)
+
+// SignInTwoFactor completes the sign in of a 2FA account: it trades the
+// challenge handed out by SignIn plus a valid code for a real session
+func (App *WebApp) SignInTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var request models.TwoFactor
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	challenge, err := App.Sessions.GetMFAChallenge(request.Challenge)
+	if err != nil {
+		if errors.Is(err, models.ErrInvalidMFAChallenge) {
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	// wrong codes count against the account's sign in lockout like wrong
+	// passwords do, or new challenges would allow guessing codes forever
+	user, err := App.Users.GetUserByID(challenge.UserID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	accountKeys := models.LoginAccountKeys(user)
+	ipKey := models.LoginIPKey(clientIP(r))
+	lockedFor, err := App.LoginAttempts.LockedFor(append(accountKeys, ipKey)...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	if lockedFor > 0 {
+		writeLockedOut(w, lockedFor)
+		return
+	}
+
+	if err := App.Users.VerifySecondFactor(challenge.UserID, request.Code); err != nil {
+		if errors.Is(err, models.ErrInvalidTOTPCode) {
+			if err := App.Sessions.FailMFAChallenge(challenge.ID); err != nil {
+				writeError(w, http.StatusInternalServerError, "")
+				return
+			}
+			App.audit(r, challenge.UserID, models.EventSignInFailed, models.LogWarning, "failed sign in: wrong two-factor code")
+			for _, key := range accountKeys {
+				App.recordLoginFailure(r, user, key, models.LoginIdentifierThreshold)
+			}
+			App.recordLoginFailure(r, user, ipKey, models.LoginIPThreshold)
+			writeError(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.resetLoginFailures(r, user.ID, accountKeys...); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Sessions.DeleteMFAChallenge(challenge.ID); err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	App.startSession(w, r, challenge.UserID, challenge.RememberMe)
+}
+
+// EnrollTOTP starts 2FA enrollment and returns the secret and otpauth URI
+func (App *WebApp) EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	secret, uri, err := App.Users.BeginTOTPEnrollment(user.ID)
+	if err != nil {
+		if errors.Is(err, models.ErrTOTPAlreadyEnabled) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, models.TwoFactor{Secret: secret, URI: uri})
+}
+
+// ConfirmTOTP enables 2FA with a first valid code and returns the recovery codes
+func (App *WebApp) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var request models.TwoFactor
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	codes, err := App.Users.ConfirmTOTP(user.ID, request.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrInvalidTOTPCode), errors.Is(err, models.ErrTOTPNotEnrolled):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, models.ErrTOTPAlreadyEnabled):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "")
+		}
+		return
+	}
+
+	encodeJson(w, http.StatusOK, models.TwoFactor{RecoveryCodes: codes})
+}
+
+// DisableTOTP turns 2FA off, given a valid code or recovery code
+func (App *WebApp) DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var request models.TwoFactor
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := App.Users.DisableTOTP(user.ID, request.Code); err != nil {
+		if errors.Is(err, models.ErrInvalidTOTPCode) || errors.Is(err, models.ErrTOTPNotEnabled) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes, given a valid code
+func (App *WebApp) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	var request models.TwoFactor
+	if err := decodeJson(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	if err := App.Users.VerifySecondFactor(user.ID, request.Code); err != nil {
+		if errors.Is(err, models.ErrInvalidTOTPCode) || errors.Is(err, models.ErrTOTPNotEnabled) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	codes, err := App.Users.ReplaceRecoveryCodes(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, models.TwoFactor{RecoveryCodes: codes})
+}
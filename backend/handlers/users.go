@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"echohub/models"
+)
+
+const (
+	profilePostsPageSize    = 10
+	profilePostsMaxPageSize = 50
+
+	userSearchPageSize    = 10
+	userSearchMaxPageSize = 50
+	userSearchMaxQuery    = 50
+
+	followListPageSize    = 20
+	followListMaxPageSize = 100
+)
+
+// GetProfile returns a member's public profile with a page of their posts,
+// newest first. Query parameters: start_id (id of the last post seen) and n.
+func (App *WebApp) GetProfile(w http.ResponseWriter, r *http.Request) {
+	viewer, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	query := r.URL.Query()
+	invalid := map[string]string{}
+	filter := &models.PostFilter{
+		Target:  "user",
+		StartID: queryInt(query, "start_id", -1, 1, math.MaxInt32, invalid),
+		NPost:   queryInt(query, "n", profilePostsPageSize, 1, profilePostsMaxPageSize, invalid),
+	}
+	if len(invalid) > 0 {
+		writeValidationError(w, &models.ValidationError{Fields: invalid})
+		return
+	}
+
+	profile, err := App.Users.GetProfile(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	profile.IsFollowed, err = App.Follows.IsFollowing(viewer.ID, profile.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	filter.UserID = profile.ID
+	posts, err, _ := App.Posts.FilterPosts(filter, viewer.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+	profile.Posts = posts
+	if profile.Posts == nil {
+		profile.Posts = []models.Post{}
+	}
+
+	encodeJson(w, http.StatusOK, profile)
+}
+
+// SearchUsers backs @mention autocomplete and the new conversation picker.
+// Query parameters: q, offset and n.
+func (App *WebApp) SearchUsers(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	query := r.URL.Query()
+	invalid := map[string]string{}
+	offset := queryInt(query, "offset", 0, 0, math.MaxInt32, invalid)
+	limit := queryInt(query, "n", userSearchPageSize, 1, userSearchMaxPageSize, invalid)
+	if len([]rune(query.Get("q"))) > userSearchMaxQuery {
+		invalid["q"] = fmt.Sprintf("q must be at most %d characters long", userSearchMaxQuery)
+	}
+	if len(invalid) > 0 {
+		writeValidationError(w, &models.ValidationError{Fields: invalid})
+		return
+	}
+
+	users, err := App.Users.SearchUsers(query.Get("q"), user.ID, offset, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, users)
+}
+
+// Follow makes the caller follow a member, whose posts then show up in the
+// "following" feed. Following someone twice is not an error.
+func (App *WebApp) Follow(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	followeeID, err := App.Users.GetUserIDByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Follows.Follow(user.ID, followeeID); err != nil {
+		if errors.Is(err, models.ErrSelfFollow) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Unfollow stops the caller following a member
+func (App *WebApp) Unfollow(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	followeeID, err := App.Users.GetUserIDByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Follows.Unfollow(user.ID, followeeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "you don't follow this user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFollowers lists who follows a member, most recent first.
+// Query parameters: offset and n.
+func (App *WebApp) GetFollowers(w http.ResponseWriter, r *http.Request) {
+	App.listFollows(w, r, App.Follows.GetFollowers)
+}
+
+// GetFollowing lists who a member follows, most recent first.
+// Query parameters: offset and n.
+func (App *WebApp) GetFollowing(w http.ResponseWriter, r *http.Request) {
+	App.listFollows(w, r, App.Follows.GetFollowing)
+}
+
+func (App *WebApp) listFollows(w http.ResponseWriter, r *http.Request, list func(userID, offset, limit int) ([]models.UserSummary, error)) {
+	query := r.URL.Query()
+	invalid := map[string]string{}
+	offset := queryInt(query, "offset", 0, 0, math.MaxInt32, invalid)
+	limit := queryInt(query, "n", followListPageSize, 1, followListMaxPageSize, invalid)
+	if len(invalid) > 0 {
+		writeValidationError(w, &models.ValidationError{Fields: invalid})
+		return
+	}
+
+	userID, err := App.Users.GetUserIDByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	users, err := list(userID, offset, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, users)
+}
+
+// Block stops a member messaging the caller, and the other way round, and
+// hides their posts, comments and typing indicators from the caller
+func (App *WebApp) Block(w http.ResponseWriter, r *http.Request) {
+	App.setBlock(w, r, models.BlockKindBlock)
+}
+
+// Mute hides a member's posts, comments and typing indicators from the
+// caller, without stopping private messages
+func (App *WebApp) Mute(w http.ResponseWriter, r *http.Request) {
+	App.setBlock(w, r, models.BlockKindMute)
+}
+
+func (App *WebApp) Unblock(w http.ResponseWriter, r *http.Request) {
+	App.removeBlock(w, r, models.BlockKindBlock)
+}
+
+func (App *WebApp) Unmute(w http.ResponseWriter, r *http.Request) {
+	App.removeBlock(w, r, models.BlockKindMute)
+}
+
+// ListBlocks returns the members the caller blocked
+func (App *WebApp) ListBlocks(w http.ResponseWriter, r *http.Request) {
+	App.listBlocks(w, r, models.BlockKindBlock)
+}
+
+// ListMutes returns the members the caller muted
+func (App *WebApp) ListMutes(w http.ResponseWriter, r *http.Request) {
+	App.listBlocks(w, r, models.BlockKindMute)
+}
+
+func (App *WebApp) setBlock(w http.ResponseWriter, r *http.Request, kind string) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	blockedID, err := App.Users.GetUserIDByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Blocks.Set(user.ID, blockedID, kind); err != nil {
+		if errors.Is(err, models.ErrSelfBlock) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (App *WebApp) removeBlock(w http.ResponseWriter, r *http.Request, kind string) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	blockedID, err := App.Users.GetUserIDByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	if err := App.Blocks.Remove(user.ID, blockedID, kind); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			message := "you haven't blocked this user"
+			if kind == models.BlockKindMute {
+				message = "you haven't muted this user"
+			}
+			writeError(w, http.StatusNotFound, message)
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (App *WebApp) listBlocks(w http.ResponseWriter, r *http.Request, kind string) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	users, err := App.Blocks.List(user.ID, kind)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, users)
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"echohub/mailer"
+	"echohub/models"
+)
+
+// VerifyEmail consumes the signed token from a verification link
+func (App *WebApp) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var verification models.EmailVerification
+	if err := decodeJson(r, &verification); err != nil {
+		writeError(w, http.StatusBadRequest, "")
+		return
+	}
+
+	userID, email, err := models.ParseEmailVerification(App.Secret, verification.Token)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := App.Users.MarkEmailVerified(userID, email); err != nil {
+		if errors.Is(err, models.ErrInvalidVerification) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	encodeJson(w, http.StatusOK, nil)
+}
+
+// ResendVerification mails a fresh verification link, throttled per user
+func (App *WebApp) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	user, ok := r.Context().Value(contextKeyUser).(*models.User)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "")
+		return
+	}
+
+	if user.EmailVerified {
+		writeError(w, http.StatusConflict, "email already verified")
+		return
+	}
+
+	if !App.ResendRl.AllowKey(strconv.Itoa(user.ID)) {
+		writeError(w, http.StatusTooManyRequests, "")
+		return
+	}
+
+	App.sendVerificationMail(user.ID, user.FirstName, user.Email)
+	encodeJson(w, http.StatusAccepted, nil)
+}
+
+// sendVerificationMail sends the signed verification link in the background
+func (App *WebApp) sendVerificationMail(userID int, firstName, email string) {
+	token := models.SignEmailVerification(App.Secret, userID, email)
+	link := App.BaseURL + "/verify-email?token=" + url.QueryEscape(token)
+
+	go func() {
+		err := App.Mailer.Send(mailer.Mail{
+			To:      email,
+			Subject: "Confirm your email address",
+			Body: "Hi " + firstName + ",\n\n" +
+				"Welcome aboard! Please confirm your email address by opening the link below " +
+				"within the next 48 hours:\n\n" + link + "\n\n" +
+				"You won't be able to post, comment or chat until it's confirmed.",
+		})
+		if err != nil {
+			log.Println("❌ Failed to send verification mail:", err)
+		}
+	}()
+}
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/rand"
 	"database/sql"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -12,18 +15,28 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"echohub/handlers"
+	"echohub/mailer"
 	"echohub/models"
 )
 
 func main() {
-	db, err := sql.Open("sqlite3", "./db/app.db")
+	db, err := sql.Open("sqlite3", "./db/app.db?_foreign_keys=on")
 	if err != nil {
 		log.Fatalln(err)
 	}
+	if err := models.Migrate(db); err != nil {
+		log.Fatalln(err)
+	}
+
+	// extra origins (besides our own) allowed to send authenticated requests
+	origins := handlers.NewOriginGuard(os.Getenv("ALLOWED_ORIGINS"))
 
 	webForum := handlers.WebApp{
 		Users: &models.UserModel{
-			DB: db,
+			DB:      db,
+			Hasher:  passwordHasher(),
+			Policy:  policy(),
+			Avatars: avatarProvider(),
 		},
 		Sessions: &models.SessionModel{
 			DB: db,
@@ -43,21 +56,54 @@ func main() {
 		Messages: &models.MessageModel{
 			DB: db,
 		},
+		PasswordResets: &models.PasswordResetModel{
+			DB: db,
+		},
+		LoginAttempts: &models.LoginAttemptModel{
+			DB: db,
+		},
+		Logs: &models.LogModel{
+			DB: db,
+		},
+		APITokens: &models.APITokenModel{
+			DB: db,
+		},
+		Exports: &models.ExportJobModel{
+			DB: db,
+		},
+		Follows: &models.FollowModel{
+			DB: db,
+		},
+		Blocks: &models.BlockModel{
+			DB: db,
+		},
+		Settings: &models.SettingsModel{
+			DB: db,
+		},
 		Hub: handlers.WSHub{
 			Upgrader: websocket.Upgrader{
-				CheckOrigin: func(r *http.Request) bool { return true },
+				CheckOrigin: origins.CheckOrigin,
 			},
 			Clients:   make(map[*websocket.Conn]*models.User),
+			Online:    make(map[int]int),
 			Broadcast: make(chan models.Message),
 			Lock:      sync.Mutex{},
 		},
-		Rl: handlers.NewRateLimiter(20, time.Second),
+		Rl:       handlers.NewRateLimiter(20, time.Second),
+		Origins:  origins,
+		ResendRl: handlers.NewRateLimiter(3, time.Hour),
+		Mailer:   newMailer(),
+		Secret:   appSecret(),
 	}
 
 	port := ":" + os.Getenv("PORT")
 	if port == ":" {
 		port += "8080"
 	}
+	webForum.BaseURL = os.Getenv("APP_URL")
+	if webForum.BaseURL == "" {
+		webForum.BaseURL = "http://localhost" + port
+	}
 	server := http.Server{
 		Addr:    port,
 		Handler: webForum.NewRouter(),
@@ -65,9 +111,134 @@ func main() {
 
 	go webForum.BroadcastMessages()
 
+	// no export job survives a restart: the goroutines building them are gone
+	if failed, err := webForum.Exports.FailStaleJobs(time.Now()); err != nil {
+		log.Fatalln(err)
+	} else if failed > 0 {
+		log.Printf("failed %d exports interrupted by the last shutdown\n", failed)
+	}
+	// exports hold personal data: EXPORT_RETENTION_DAYS=0 keeps them forever
+	go webForum.PruneExports(time.Duration(envInt("EXPORT_RETENTION_DAYS", 7)) * 24 * time.Hour)
+
+	// LOG_RETENTION_DAYS=0 keeps the logs forever
+	if days := envInt("LOG_RETENTION_DAYS", 90); days > 0 {
+		go webForum.PruneLogs(time.Duration(days) * 24 * time.Hour)
+	}
+
 	log.Println("server listening on http://localhost" + port)
 
 	if err := server.ListenAndServe(); err != nil {
 		log.Fatalln(err)
 	}
 }
+
+// newMailer sends through SMTP when SMTP_HOST is set, otherwise mails are
+// written to MAIL_LOG_FILE (or the server log) for local use.
+func newMailer() mailer.Mailer {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return &mailer.LogMailer{Path: os.Getenv("MAIL_LOG_FILE")}
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &mailer.SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+}
+
+// passwordHasher builds the password hashing settings from PASSWORD_HASH_ALGO
+// (argon2id or bcrypt), ARGON2_MEMORY (KiB), ARGON2_ITERATIONS,
+// ARGON2_PARALLELISM and BCRYPT_COST. Unset values keep their defaults.
+// Existing hashes are upgraded to these settings as users sign in.
+func passwordHasher() *models.PasswordHasher {
+	hasher := models.DefaultPasswordHasher()
+	if algo := os.Getenv("PASSWORD_HASH_ALGO"); algo != "" {
+		hasher.Algorithm = algo
+	}
+	hasher.Argon2.Memory = uint32(envInt("ARGON2_MEMORY", int(hasher.Argon2.Memory)))
+	hasher.Argon2.Iterations = uint32(envInt("ARGON2_ITERATIONS", int(hasher.Argon2.Iterations)))
+	hasher.Argon2.Parallelism = uint8(envInt("ARGON2_PARALLELISM", int(hasher.Argon2.Parallelism)))
+	hasher.BcryptCost = envInt("BCRYPT_COST", hasher.BcryptCost)
+
+	if err := hasher.Validate(); err != nil {
+		log.Fatalln("password hashing:", err)
+	}
+	return hasher
+}
+
+func envInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Fatalf("%s must be a non-negative number, got %q", name, value)
+	}
+	return n
+}
+
+// policy loads the password, username and name rules from the JSON file at
+// POLICY_FILE (defaults otherwise) and, when BREACHED_PASSWORDS_FILE is set,
+// rejects the passwords it lists
+func policy() *models.Policy {
+	policy, err := models.LoadPolicy(os.Getenv("POLICY_FILE"))
+	if err != nil {
+		log.Fatalln("policy:", err)
+	}
+	if path := os.Getenv("BREACHED_PASSWORDS_FILE"); path != "" {
+		if err := policy.LoadBreachedPasswords(path); err != nil {
+			log.Fatalln("breached passwords:", err)
+		}
+	}
+	return policy
+}
+
+// avatarProvider builds the avatar providers of new accounts from
+// AVATAR_PROVIDERS, a comma separated fallback chain of "identicon" (local)
+// and "dicebear" (remote, DICEBEAR_URL and AVATAR_TIMEOUT in seconds).
+// It defaults to "identicon" so signups never need the network.
+func avatarProvider() models.AvatarProvider {
+	names := os.Getenv("AVATAR_PROVIDERS")
+	if names == "" {
+		names = "identicon"
+	}
+
+	var chain models.AvatarChain
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "identicon":
+			chain = append(chain, models.IdenticonProvider{})
+		case "dicebear":
+			chain = append(chain, models.DiceBearProvider{
+				BaseURL: os.Getenv("DICEBEAR_URL"),
+				Timeout: time.Duration(envInt("AVATAR_TIMEOUT", 5)) * time.Second,
+			})
+		default:
+			log.Fatalf("AVATAR_PROVIDERS: unknown avatar provider %q", name)
+		}
+	}
+	return chain
+}
+
+// appSecret reads the key signing emailed links from APP_SECRET. Without it a
+// random key is used, so links stop working once the server restarts.
+func appSecret() []byte {
+	if secret := os.Getenv("APP_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	log.Println("⚠️ APP_SECRET is not set, using a random key for this run")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		log.Fatalln(err)
+	}
+	return secret
+}
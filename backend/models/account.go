@@ -0,0 +1,196 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// account deletion modes
+const (
+	DeleteModeAnonymize = "anonymize" // keep posts and comments under a "deleted" placeholder account
+	DeleteModeCascade   = "delete"    // remove the account along with everything it authored
+)
+
+var ErrWrongPassword = errors.New("current password is incorrect")
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	Password        string `json:"password"`
+	RepeatedPass    string `json:"repeated_password"`
+}
+
+type AccountDeletion struct {
+	Password string `json:"password"`
+	Mode     string `json:"mode"`
+}
+
+// UpdateProfile applies the non-empty fields of a validated profile update.
+// Changing the email marks it unverified again; it reports whether it did.
+func (um *UserModel) UpdateProfile(user User) (bool, error) {
+	query := `
+		UPDATE users SET
+			first_name = COALESCE(NULLIF(?, ''), first_name),
+			last_name = COALESCE(NULLIF(?, ''), last_name),
+			username = COALESCE(NULLIF(?, ''), username),
+			email = COALESCE(NULLIF(?, ''), email),
+			email_verified_at = CASE WHEN ? != '' THEN NULL ELSE email_verified_at END
+		WHERE id = ?
+	`
+	_, err := um.DB.Exec(query,
+		strings.TrimSpace(user.FirstName),
+		strings.TrimSpace(user.LastName),
+		user.UserName,
+		user.Email,
+		user.Email,
+		user.ID,
+	)
+	if err != nil {
+		switch {
+		case isUniqueViolation(err, "users.email"):
+			return false, fieldError("email", errors.New("this email '"+user.Email+"' is already registered"))
+		case isUniqueViolation(err, "users.username"):
+			return false, fieldError("username", errors.New("'"+user.UserName+"' is already taken"))
+		}
+		return false, err
+	}
+	return user.Email != "", nil
+}
+
+// UpdateAvatar points the user's profile_img at a new avatar and returns
+// the one it replaced
+func (um *UserModel) UpdateAvatar(userID int, profileImg string) (string, error) {
+	tx, err := um.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previous string
+	if err := tx.QueryRow(`SELECT profile_img FROM users WHERE id = ?`, userID).Scan(&previous); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(`UPDATE users SET profile_img = ? WHERE id = ?`, profileImg, userID); err != nil {
+		return "", err
+	}
+	return previous, tx.Commit()
+}
+
+// AvatarInUse reports whether any account still shows profileImg; files
+// are named after their content so two accounts can share one
+func (um *UserModel) AvatarInUse(profileImg string) (bool, error) {
+	var inUse bool
+	err := um.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM users WHERE profile_img = ?)`, profileImg).Scan(&inUse)
+	return inUse, err
+}
+
+// CheckPassword compares password with the one stored for the user
+func (um *UserModel) CheckPassword(userID int, password string) error {
+	var hashed []byte
+	if err := um.DB.QueryRow(`SELECT hashed_password FROM users WHERE id = ?`, userID).Scan(&hashed); err != nil {
+		return err
+	}
+	return um.checkPassword(userID, hashed, password)
+}
+
+// DeleteUser removes an account. Messages and conversations reference users
+// without ON DELETE CASCADE so they go first; posts, comments, sessions and
+// the rest follow through the cascades of schema.sql (foreign keys must be on).
+func (um *UserModel) DeleteUser(userID int) error {
+	tx, err := um.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	queries := []string{
+		`DELETE FROM messages WHERE conversation_id IN (
+			SELECT id FROM conversations WHERE user1_id = ? OR user2_id = ?)`,
+		`DELETE FROM conversations WHERE user1_id = ? OR user2_id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := tx.Exec(query, userID, userID); err != nil {
+			return fmt.Errorf("failed to delete user data: %w", err)
+		}
+	}
+
+	res, err := tx.Exec(`DELETE FROM users WHERE id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return tx.Commit()
+}
+
+// anonymizedUsername is the placeholder username of an anonymized account.
+// The '-' is refused by the username policy so nobody can sign up with it.
+func anonymizedUsername(userID int) string {
+	return fmt.Sprintf("deleted-%d", userID)
+}
+
+// AnonymizeUser scrubs every personal field of an account but keeps the row,
+// so posts, comments and conversations stay readable under a placeholder
+// author. The account can't be signed into anymore.
+func (um *UserModel) AnonymizeUser(userID int) error {
+	tx, err := um.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	placeholder := anonymizedUsername(userID)
+	res, err := tx.Exec(`
+		UPDATE users SET
+			first_name = 'Deleted',
+			last_name = 'User',
+			username = ?,
+			email = ?,
+			birth_date = '',
+			hashed_password = '!',
+			profile_img = '',
+			role = 'member',
+			email_verified_at = NULL,
+			totp_secret = NULL,
+			totp_enabled_at = NULL,
+			last_seen_at = NULL,
+			deleted_at = ?
+		WHERE id = ? AND deleted_at IS NULL`,
+		placeholder, placeholder+"@deleted.invalid", time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to anonymize user: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	// credentials, pending tokens and data exports have no reason to outlive the account
+	for _, table := range []string{"sessions", "refresh_tokens", "api_tokens", "password_resets", "mfa_challenges", "recovery_codes", "export_jobs"} {
+		if _, err := tx.Exec(`DELETE FROM `+table+` WHERE user_id = ?`, userID); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", table, err)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM follows WHERE follower_id = ? OR followee_id = ?`, userID, userID); err != nil {
+		return fmt.Errorf("failed to clear follows: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM blocks WHERE blocker_id = ? OR blocked_id = ?`, userID, userID); err != nil {
+		return fmt.Errorf("failed to clear blocks: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM user_settings WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to clear settings: %w", err)
+	}
+
+	return tx.Commit()
+}
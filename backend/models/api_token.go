@@ -0,0 +1,196 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// API token scopes
+const (
+	ScopeRead  = "read"  // browse posts, comments and categories
+	ScopeWrite = "write" // create posts and comments
+	ScopeChat  = "chat"  // private messages and the /ws chat
+)
+
+const apiTokenPrefix = "ehp_"
+
+var (
+	ErrInvalidAPIToken = errors.New("invalid api token")
+	validScopes        = []string{ScopeRead, ScopeWrite, ScopeChat}
+)
+
+type APIToken struct {
+	ID         int        `json:"id"`
+	UserID     int        `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	Token      string     `json:"token,omitempty"` // plain token, only returned once on creation
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+type APITokenModel struct {
+	DB *sql.DB
+}
+
+// HasScope reports whether the token was granted scope
+func (t *APIToken) HasScope(scope string) bool {
+	return slices.Contains(t.Scopes, scope)
+}
+
+func ValidateAPIToken(token *APIToken) error {
+	if token == nil {
+		return errors.New("token is nil")
+	}
+
+	token.Name = strings.TrimSpace(token.Name)
+	if err := fieldErrors(map[string]error{
+		"name":   textCheck("token name", token.Name, 50),
+		"scopes": scopesCheck(token.Scopes),
+	}); err != nil {
+		return err
+	}
+
+	slices.Sort(token.Scopes)
+	token.Scopes = slices.Compact(token.Scopes)
+	return nil
+}
+
+func scopesCheck(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("token must have at least one scope")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(validScopes, scope) {
+			return fmt.Errorf("invalid scope %q: must be 'read', 'write' or 'chat'", scope)
+		}
+	}
+	return nil
+}
+
+// InsertToken creates a token for the user and returns it with its plain value
+func (atm *APITokenModel) InsertToken(token APIToken) (APIToken, error) {
+	secret, err := generateToken()
+	if err != nil {
+		return APIToken{}, err
+	}
+	token.Token = apiTokenPrefix + secret
+	token.CreatedAt = time.Now()
+
+	query := `
+		INSERT INTO api_tokens (user_id, name, token_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	res, err := atm.DB.Exec(query, token.UserID, token.Name, hashToken(token.Token), strings.Join(token.Scopes, ","), token.CreatedAt)
+	if err != nil {
+		return APIToken{}, fmt.Errorf("failed to insert api token: %w", err)
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return APIToken{}, err
+	}
+	token.ID = int(id)
+	return token, nil
+}
+
+// GetUserTokens lists the user's tokens, without their secret
+func (atm *APITokenModel) GetUserTokens(userID int) ([]APIToken, error) {
+	query := `
+		SELECT id, user_id, name, scopes, created_at, last_used_at
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY id DESC
+	`
+	rows, err := atm.DB.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// DeleteToken revokes one of the user's tokens
+func (atm *APITokenModel) DeleteToken(userID, tokenID int) error {
+	res, err := atm.DB.Exec(`DELETE FROM api_tokens WHERE id = ? AND user_id = ?`, tokenID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserTokens revokes every token of the user, when their password
+// changes: a token minted by whoever had the old one mustn't outlive it
+func (atm *APITokenModel) DeleteUserTokens(userID int) error {
+	_, err := atm.DB.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID)
+	return err
+}
+
+// Authenticate resolves a bearer token and stamps its last use
+func (atm *APITokenModel) Authenticate(plain string) (APIToken, error) {
+	if !strings.HasPrefix(plain, apiTokenPrefix) {
+		return APIToken{}, ErrInvalidAPIToken
+	}
+
+	query := `
+		SELECT id, user_id, name, scopes, created_at, last_used_at
+		FROM api_tokens
+		WHERE token_hash = ?
+	`
+	token, err := scanAPIToken(atm.DB.QueryRow(query, hashToken(plain)))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return APIToken{}, ErrInvalidAPIToken
+		}
+		return APIToken{}, err
+	}
+
+	now := time.Now()
+	if _, err := atm.DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, now, token.ID); err != nil {
+		return APIToken{}, err
+	}
+	token.LastUsedAt = &now
+	return token, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIToken(row rowScanner) (APIToken, error) {
+	var token APIToken
+	var scopes string
+	var lastUsed sql.NullTime
+	if err := row.Scan(&token.ID, &token.UserID, &token.Name, &scopes, &token.CreatedAt, &lastUsed); err != nil {
+		return APIToken{}, err
+	}
+	token.Scopes = strings.Split(scopes, ",")
+	if lastUsed.Valid {
+		token.LastUsedAt = &lastUsed.Time
+	}
+	return token, nil
+}
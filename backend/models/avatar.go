@@ -1,29 +1,176 @@
 package models
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"image/png"
 	"io"
-	"math/rand"
+	"log"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 )
 
-// Helper function to randomly select from a list
-func pick(options []string) string {
-	return options[rand.Intn(len(options))]
+// AvatarProvider draws the picture given to new accounts from a seed (the
+// username). The image can be in any format SaveAvatar accepts.
+type AvatarProvider interface {
+	Name() string
+	Avatar(seed, gender string) ([]byte, error)
 }
 
-// AssignAvatar downloads a Dicebear "adventurer" avatar and saves it as a PNG.
-func AssignAvatar(username, gender string) (string, error) {
-	rand.Seed(time.Now().UnixNano())
+// AvatarChain asks its providers in order and keeps the first image that
+// decodes, so a remote provider can fall back on a local one
+type AvatarChain []AvatarProvider
 
-	baseURL := "https://api.dicebear.com/9.x/adventurer/png"
-	seed := url.QueryEscape(username)
+func (chain AvatarChain) Name() string {
+	names := make([]string, len(chain))
+	for i, provider := range chain {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (chain AvatarChain) Avatar(seed, gender string) ([]byte, error) {
+	var errs []error
+	for _, provider := range chain {
+		data, err := provider.Avatar(seed, gender)
+		if err == nil {
+			_, err = decodeAvatar(data, sniffImageType(data))
+		}
+		if err != nil {
+			log.Printf("⚠️ %s avatar failed: %v", provider.Name(), err)
+			errs = append(errs, fmt.Errorf("%s: %w", provider.Name(), err))
+			continue
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("no avatar provider succeeded: %w", errors.Join(errs...))
+}
+
+// seedHash turns a seed into the bytes every provider derives its choices
+// from, so the same username always gets the same avatar
+func seedHash(seed string) [32]byte {
+	return sha256.Sum256([]byte(strings.ToLower(seed)))
+}
+
+// IdenticonProvider draws a symmetric 5x5 identicon locally, without any
+// network access
+type IdenticonProvider struct {
+	Size int // pixels, 128 when 0
+}
+
+func (IdenticonProvider) Name() string {
+	return "identicon"
+}
+
+func (p IdenticonProvider) Avatar(seed, _ string) ([]byte, error) {
+	const cells = 5
+	size := p.Size
+	if size == 0 {
+		size = 128
+	}
+	cell := size / (cells + 1) // leaves half a cell of margin on each side
+	margin := (size - cell*cells) / 2
+
+	hash := seedHash(seed)
+	background := color.RGBA{0xF0, 0xF0, 0xF0, 0xFF}
+	foreground := hslColor(float64(binary.BigEndian.Uint16(hash[0:2]))/65536*360, 0.55, 0.5)
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{background, foreground})
+	for row := 0; row < cells; row++ {
+		// the left three columns come from the hash, the right two mirror them
+		for col := 0; col < (cells+1)/2; col++ {
+			bit := row*3 + col
+			if hash[2+bit/8]>>(bit%8)&1 == 0 {
+				continue
+			}
+			for _, c := range []int{col, cells - 1 - col} {
+				x0, y0 := margin+c*cell, margin+row*cell
+				for y := y0; y < y0+cell; y++ {
+					for x := x0; x < x0+cell; x++ {
+						img.SetColorIndex(x, y, 1)
+					}
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// hslColor converts a hue in degrees, saturation and lightness to RGB
+func hslColor(h, s, l float64) color.RGBA {
+	c := (1 - abs(2*l-1)) * s
+	x := c * (1 - abs(mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 0xFF}
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+func mod(a, b float64) float64 {
+	return a - b*float64(int(a/b))
+}
+
+// DiceBearProvider downloads an "adventurer" avatar from DiceBear. The
+// username itself is never sent: traits and the seed come from its hash.
+type DiceBearProvider struct {
+	BaseURL string        // defaults to the public DiceBear API
+	Timeout time.Duration // 5s when 0
+}
+
+func (DiceBearProvider) Name() string {
+	return "dicebear"
+}
+
+func (p DiceBearProvider) Avatar(seed, gender string) ([]byte, error) {
+	baseURL := p.BaseURL
+	if baseURL == "" {
+		baseURL = "https://api.dicebear.com/9.x/adventurer/png"
+	}
+	timeout := p.Timeout
+	if timeout == 0 {
+		timeout = 5 * time.Second
+	}
+
+	hash := seedHash(seed)
+	rng := rand.New(rand.NewPCG(binary.BigEndian.Uint64(hash[0:8]), binary.BigEndian.Uint64(hash[8:16])))
+	pick := func(options []string) string {
+		return options[rng.IntN(len(options))]
+	}
 
 	// Gender-based traits
 	var hairOptions, accessoryOptions []string
@@ -35,12 +182,12 @@ func AssignAvatar(username, gender string) (string, error) {
 		hairOptions = []string{"long01", "long02", "long03", "long04", "long05", "long06"}
 		accessoryOptions = []string{"earrings:variant01", "earrings:variant03", "glasses:variant02"}
 	default:
-		return "", errors.New("invalid gender 'male' or 'female'")
+		return nil, errors.New("invalid gender 'male' or 'female'")
 	}
 
 	// Build query params
 	params := url.Values{}
-	params.Set("seed", seed)
+	params.Set("seed", hex.EncodeToString(hash[:16]))
 	params.Set("size", "128")
 	params.Set("hair", pick(hairOptions))
 	params.Set("hairColor", pick([]string{"0e0e0e", "3eac2c", "6a4e35", "dba3be", "ab2a18"}))
@@ -51,51 +198,32 @@ func AssignAvatar(username, gender string) (string, error) {
 	params.Set("features", pick([]string{"freckles", "blush", "birthmark"}))
 	params.Set("featuresProbability", "100")
 
-	if len(accessoryOptions) > 0 {
-		acc := pick(accessoryOptions)
-		if strings.HasPrefix(acc, "glasses") {
-			params.Set("glasses", strings.TrimPrefix(acc, "glasses:"))
-			params.Set("glassesProbability", "100")
-		}
-		if strings.HasPrefix(acc, "earrings") {
-			params.Set("earrings", strings.TrimPrefix(acc, "earrings:"))
-			params.Set("earringsProbability", "100")
-		}
+	acc := pick(accessoryOptions)
+	if strings.HasPrefix(acc, "glasses") {
+		params.Set("glasses", strings.TrimPrefix(acc, "glasses:"))
+		params.Set("glassesProbability", "100")
+	}
+	if strings.HasPrefix(acc, "earrings") {
+		params.Set("earrings", strings.TrimPrefix(acc, "earrings:"))
+		params.Set("earringsProbability", "100")
 	}
-
-	// Final URL
-	avatarURL := fmt.Sprintf("%s?%s", baseURL, params.Encode())
 
 	// HTTP request
-	resp, err := http.Get(avatarURL)
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(baseURL + "?" + params.Encode())
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch avatar: %w", err)
+		return nil, fmt.Errorf("failed to fetch avatar: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("avatar API status code: %d, message: %s", resp.StatusCode, string(body))
-	}
-
-	// Ensure target directory exists
-	dir := "../frontend/public/images/avatars/"
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return "", fmt.Errorf("failed to create directory: %w", err)
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("avatar API status code: %d, message: %s", resp.StatusCode, string(body))
 	}
 
-	// Save image file
-	filePath := filepath.Join(dir, username+".png")
-	outFile, err := os.Create(filePath)
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxAvatarBytes+1))
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to read avatar: %w", err)
 	}
-	defer outFile.Close()
-
-	if _, err := io.Copy(outFile, resp.Body); err != nil {
-		return "", fmt.Errorf("failed to save image: %w", err)
-	}
-
-	// Return relative path
-	return "/public/images/avatars/" + username + ".png", nil
+	return data, nil
 }
@@ -0,0 +1,228 @@
+package models
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	// MaxAvatarBytes is the largest avatar upload accepted
+	MaxAvatarBytes = 5 << 20
+	// maxAvatarSide bounds the decoded image, against decompression bombs
+	maxAvatarSide = 4096
+
+	avatarDir       = "../frontend/public/images/avatars/"
+	avatarURLPrefix = "/public/images/avatars/"
+)
+
+// AvatarSizes are the square variants stored for each avatar, in pixels.
+// The profile_img of a user points at the largest one.
+var AvatarSizes = []int{32, 64, 128}
+
+var (
+	ErrAvatarFormat   = errors.New("avatar must be a PNG, JPEG, WebP or GIF image")
+	ErrAvatarTooLarge = fmt.Errorf("avatar must be at most %d MB", MaxAvatarBytes>>20)
+	ErrAvatarSize     = fmt.Errorf("avatar must be at most %dx%d pixels", maxAvatarSide, maxAvatarSide)
+)
+
+// avatarName matches the files written by SaveAvatar: <hash>_<size>.<ext>
+var avatarName = regexp.MustCompile(`^([0-9a-f]{32})_\d+\.(png|jpg)$`)
+
+// sniffImageType tells the real format of an image from its magic bytes,
+// whatever its file name or content type claim
+func sniffImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "jpeg"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "webp"
+	default:
+		return ""
+	}
+}
+
+// decodeAvatar decodes an image of the given format, checking its
+// dimensions before decoding the pixels. Animated GIFs keep their first frame.
+func decodeAvatar(data []byte, format string) (image.Image, error) {
+	var decodeConfig func(io.Reader) (image.Config, error)
+	var decode func(io.Reader) (image.Image, error)
+	switch format {
+	case "png":
+		decodeConfig, decode = png.DecodeConfig, png.Decode
+	case "jpeg":
+		decodeConfig, decode = jpeg.DecodeConfig, jpeg.Decode
+	case "gif":
+		decodeConfig, decode = gif.DecodeConfig, gif.Decode
+	case "webp":
+		decodeConfig, decode = webp.DecodeConfig, webp.Decode
+	default:
+		return nil, ErrAvatarFormat
+	}
+
+	config, err := decodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarFormat
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return nil, ErrAvatarFormat
+	}
+	if config.Width > maxAvatarSide || config.Height > maxAvatarSide {
+		return nil, ErrAvatarSize
+	}
+
+	img, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrAvatarFormat
+	}
+	return img, nil
+}
+
+// SaveAvatar checks an image, crops it to a centered square and stores it
+// in every AvatarSizes, returning the public path of the largest one.
+// Re-encoding the pixels drops any metadata (EXIF, GPS, comments...).
+// Files are named after a hash of their content, so uploading the same
+// image twice reuses them and names tell nothing about their owner.
+// Errors about the image itself are *ValidationError on "avatar".
+func SaveAvatar(data []byte) (string, error) {
+	if len(data) > MaxAvatarBytes {
+		return "", fieldError("avatar", ErrAvatarTooLarge)
+	}
+	format := sniffImageType(data)
+	img, err := decodeAvatar(data, format)
+	if err != nil {
+		return "", fieldError("avatar", err)
+	}
+
+	// photos stay JPEG, anything that may be transparent becomes PNG
+	ext := "png"
+	if format == "jpeg" {
+		ext = "jpg"
+	}
+
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+	square := image.Rect(x0, y0, x0+side, y0+side)
+
+	variants := make(map[int][]byte, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		dst := image.NewRGBA(image.Rect(0, 0, size, size))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, square, draw.Src, nil)
+
+		var buf bytes.Buffer
+		if ext == "jpg" {
+			err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 90})
+		} else {
+			err = png.Encode(&buf, dst)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to encode avatar: %w", err)
+		}
+		variants[size] = buf.Bytes()
+	}
+
+	largest := AvatarSizes[len(AvatarSizes)-1]
+	sum := sha256.Sum256(variants[largest])
+	hash := hex.EncodeToString(sum[:16])
+
+	if err := os.MkdirAll(avatarDir, os.ModePerm); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	for size, encoded := range variants {
+		name := fmt.Sprintf("%s_%d.%s", hash, size, ext)
+		if err := writeAvatarFile(name, encoded); err != nil {
+			return "", err
+		}
+	}
+
+	return fmt.Sprintf("%s%s_%d.%s", avatarURLPrefix, hash, largest, ext), nil
+}
+
+// writeAvatarFile writes through a temporary file so a half written
+// avatar is never served
+func writeAvatarFile(name string, data []byte) error {
+	path := filepath.Join(avatarDir, name)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(avatarDir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return fmt.Errorf("failed to save image: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// AvatarVariants maps each of AvatarSizes to the public path of that
+// variant of profileImg, or returns nil for avatars stored another way
+func AvatarVariants(profileImg string) map[int]string {
+	name, ok := strings.CutPrefix(profileImg, avatarURLPrefix)
+	if !ok {
+		return nil
+	}
+	match := avatarName.FindStringSubmatch(name)
+	if match == nil {
+		return nil
+	}
+
+	variants := make(map[int]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		variants[size] = fmt.Sprintf("%s%s_%d.%s", avatarURLPrefix, match[1], size, match[2])
+	}
+	return variants
+}
+
+// RemoveAvatar deletes the files of an avatar: every variant of a hashed
+// one, or the single file of an avatar from before variants
+func RemoveAvatar(profileImg string) error {
+	name, ok := strings.CutPrefix(profileImg, avatarURLPrefix)
+	if !ok || name == "" || strings.ContainsAny(name, `/\`) {
+		return nil
+	}
+
+	paths := []string{name}
+	if variants := AvatarVariants(profileImg); variants != nil {
+		paths = paths[:0]
+		for _, variant := range variants {
+			paths = append(paths, strings.TrimPrefix(variant, avatarURLPrefix))
+		}
+	}
+	for _, path := range paths {
+		if err := os.Remove(filepath.Join(avatarDir, path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
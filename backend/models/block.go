@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Kinds of block. Both hide the other user's posts, comments and typing
+// indicators; a block also stops private messages in both directions.
+const (
+	BlockKindBlock = "block"
+	BlockKindMute  = "mute"
+)
+
+var (
+	ErrSelfBlock     = errors.New("you can't block or mute yourself")
+	ErrBlockedByUser = errors.New("you can't message this user")
+	ErrBlockedUser   = errors.New("you blocked this user, unblock them to send messages")
+)
+
+type BlockModel struct {
+	DB *sql.DB
+}
+
+// Set blocks or mutes blockedID for blockerID. A user is either blocked or
+// muted, so blocking a muted user turns the mute into a block and back.
+func (bm *BlockModel) Set(blockerID, blockedID int, kind string) error {
+	if blockerID == blockedID {
+		return ErrSelfBlock
+	}
+	_, err := bm.DB.Exec(`
+		INSERT INTO blocks (blocker_id, blocked_id, kind) VALUES (?, ?, ?)
+		ON CONFLICT (blocker_id, blocked_id) DO UPDATE SET kind = excluded.kind, created_at = CURRENT_TIMESTAMP
+		WHERE kind != excluded.kind
+	`, blockerID, blockedID, kind)
+	return err
+}
+
+// Remove lifts a block or mute, returning sql.ErrNoRows if there was none of that kind
+func (bm *BlockModel) Remove(blockerID, blockedID int, kind string) error {
+	res, err := bm.DB.Exec(`DELETE FROM blocks WHERE blocker_id = ? AND blocked_id = ? AND kind = ?`,
+		blockerID, blockedID, kind)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// List returns who userID blocked or muted, most recent first
+func (bm *BlockModel) List(userID int, kind string) ([]UserSummary, error) {
+	rows, err := bm.DB.Query(`
+		SELECT u.id, u.username, u.first_name, u.last_name, u.profile_img
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id = ? AND b.kind = ?
+		ORDER BY b.created_at DESC, u.id DESC
+	`, userID, kind)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.ProfileImg); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CheckChat tells whether senderID may message receiverID: it returns
+// ErrBlockedUser or ErrBlockedByUser when either blocked the other
+func (bm *BlockModel) CheckChat(senderID, receiverID int) error {
+	var blocker int
+	err := bm.DB.QueryRow(`
+		SELECT blocker_id FROM blocks
+		WHERE kind = 'block'
+		  AND ((blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))
+		LIMIT 1
+	`, senderID, receiverID, receiverID, senderID).Scan(&blocker)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil
+	case err != nil:
+		return err
+	case blocker == senderID:
+		return ErrBlockedUser
+	default:
+		return ErrBlockedByUser
+	}
+}
+
+// BlockedEitherWay returns the users userID blocked or was blocked by
+func (bm *BlockModel) BlockedEitherWay(userID int) (map[int]bool, error) {
+	rows, err := bm.DB.Query(`
+		SELECT blocked_id FROM blocks WHERE blocker_id = ? AND kind = 'block'
+		UNION
+		SELECT blocker_id FROM blocks WHERE blocked_id = ? AND kind = 'block'
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blocked[id] = true
+	}
+	return blocked, rows.Err()
+}
+
+// Hides reports whether viewerID blocked or muted authorID
+func (bm *BlockModel) Hides(viewerID, authorID int) (bool, error) {
+	var hidden bool
+	err := bm.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM blocks WHERE blocker_id = ? AND blocked_id = ?)`,
+		viewerID, authorID).Scan(&hidden)
+	return hidden, err
+}
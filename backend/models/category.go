@@ -2,7 +2,9 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 )
 
 type Category struct {
@@ -17,6 +19,30 @@ type CategoryModel struct {
 	DB *sql.DB
 }
 
+func ValidateCategory(category *Category) error {
+	if category == nil {
+		return errors.New("category is nil")
+	}
+
+	category.Name = strings.TrimSpace(category.Name)
+	category.Icon = strings.TrimSpace(category.Icon)
+	category.Description = strings.TrimSpace(category.Description)
+
+	var iconErr, descriptionErr error
+	if category.Icon == "" {
+		iconErr = errors.New("category icon cannot be empty or whitespace")
+	}
+	if len(category.Description) > 200 {
+		descriptionErr = errors.New("category description must be at most 200 characters long")
+	}
+
+	return fieldErrors(map[string]error{
+		"name":        textCheck("category name", category.Name, 30),
+		"icon":        iconErr,
+		"description": descriptionErr,
+	})
+}
+
 // Insert Category 
 func (cm *CategoryModel) InsertCategory(category Category) error {
 	query := `INSERT OR IGNORE INTO categories (name, description, icon) VALUES (?, ?, ?)`
@@ -4,17 +4,21 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"math"
 	"strings"
 	"time"
 )
 
 type Comment struct {
-	ID        int       `json:"id"`
-	Username  string    `json:"username"`
-	PostID    int       `json:"post_id"`
-	UserID    int       `json:"user_id"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	PostID       int        `json:"post_id"`
+	UserID       int        `json:"user_id"`
+	Content      string     `json:"content"` // RemovedPlaceholder in GetComments once deleted
+	Deleted      bool       `json:"deleted"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+	DeleteReason string     `json:"delete_reason"`
+	CreatedAt    time.Time  `json:"created_at"`
 }
 
 type CommentsFilter struct {
@@ -33,14 +37,7 @@ func ValidateComment(comment *Comment) error {
 	}
 
 	comment.Content = strings.TrimSpace(comment.Content)
-	if comment.Content == "" {
-		return errors.New("Comment cannot be empty or whitespace")
-	}
-	if len(comment.Content) > 1000 {
-		return errors.New("Comment must be at most 1000 characters long")
-	}
-
-	return nil
+	return fieldError("content", textCheck("comment", comment.Content, 1000))
 }
 
 // Insert Comment
@@ -75,38 +72,27 @@ func (cm *CommentModel) UpdateComment(commentID int, newContent string) error {
 	return nil
 }
 
-// Delete Comment
-func (cm *CommentModel) DeleteComment(commentID int) error {
-	query := `
-		DELETE FROM comments
-		WHERE id = ?`
-	res, err := cm.DB.Exec(query, commentID)
-	if err != nil {
-		return err
-	}
-	affected, err := res.RowsAffected()
-	if err != nil {
-		return err
-	}
-	if affected == 0 {
-		return errors.New("no comment found with the given ID")
-	}
-	return nil
+// DeleteComment soft deletes a comment, which stays in its thread as a
+// placeholder until restored or purged
+func (cm *CommentModel) DeleteComment(commentID, deletedBy int, reason string) error {
+	return softDelete(cm.DB, "comments", commentID, deletedBy, reason)
 }
 
 // GetComment retrieves a comment by its ID
 func (cm *CommentModel) GetComment(commentID int) (Comment, error) {
 	query := `
-		SELECT id, post_id, user_id, content, created_at
+		SELECT id, post_id, user_id, content, deleted_at, delete_reason, created_at
 		FROM comments
 		WHERE id = ?`
 
 	row := cm.DB.QueryRow(query, commentID)
 	var comment Comment
-	err := row.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt)
+	err := row.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content,
+		&comment.DeletedAt, &comment.DeleteReason, &comment.CreatedAt)
 	if err != nil {
 		return Comment{}, err
 	}
+	comment.Deleted = comment.DeletedAt != nil
 
 	return comment, nil
 }
@@ -127,8 +113,48 @@ func (cm *CommentModel) GetLastCommentID(postID int) (int, error) {
 	return lastID, nil
 }
 
-// GetComments retrieves an array of comments by post ID
-func (cm *CommentModel) GetComments(filter *CommentsFilter) ([]Comment, error) {
+// GetUserComments retrieves a page of the comments written by a user, newest
+// first, without the removed ones
+func (cm *CommentModel) GetUserComments(userID int, filter *CommentsFilter) ([]Comment, error) {
+	if filter.StartID == -1 {
+		filter.StartID = math.MaxInt32
+	}
+
+	query := `
+		SELECT
+			comments.id,
+			comments.post_id,
+			comments.user_id,
+			comments.content,
+			comments.created_at,
+			users.username
+		FROM comments
+		JOIN users ON comments.user_id = users.id
+		WHERE comments.user_id = ? AND comments.id < ? AND comments.deleted_at IS NULL
+		ORDER BY comments.id DESC
+		LIMIT ?`
+
+	rows, err := cm.DB.Query(query, userID, filter.StartID, filter.NComment)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt, &comment.Username); err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+
+	return comments, rows.Err()
+}
+
+// GetComments retrieves an array of comments by post ID, leaving out the
+// comments of users viewerID blocked or muted
+func (cm *CommentModel) GetComments(filter *CommentsFilter, viewerID int) ([]Comment, error) {
 	lastID, err := cm.GetLastCommentID(filter.PostID)
 	if err != nil {
 		return nil, err
@@ -144,15 +170,18 @@ func (cm *CommentModel) GetComments(filter *CommentsFilter) ([]Comment, error) {
     		comments.post_id,
     		comments.user_id,
     		comments.content,
+    		comments.deleted_at,
+    		comments.delete_reason,
     		comments.created_at,
     		users.username
 		FROM comments
 		JOIN users ON comments.user_id = users.id
 		WHERE comments.post_id = ? AND comments.id < ?
+		  AND comments.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)
 		ORDER BY comments.id DESC
 		LIMIT ?`
 
-	rows, err := cm.DB.Query(query, filter.PostID, filter.StartID, filter.NComment)
+	rows, err := cm.DB.Query(query, filter.PostID, filter.StartID, viewerID, filter.NComment)
 	if err != nil {
 		return nil, err
 	}
@@ -161,11 +190,15 @@ func (cm *CommentModel) GetComments(filter *CommentsFilter) ([]Comment, error) {
 	var comments []Comment
 	for rows.Next() {
 		var comment Comment
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt, &comment.Username); err != nil {
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content,
+			&comment.DeletedAt, &comment.DeleteReason, &comment.CreatedAt, &comment.Username); err != nil {
 			return nil, err
 		}
+		comment.Deleted = comment.DeletedAt != nil
+		if comment.Deleted {
+			comment.Content = RemovedPlaceholder
+		}
 		comments = append(comments, comment)
 	}
-	
-	return comments, nil
+	return comments, rows.Err()
 }
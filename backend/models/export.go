@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+type ExportJob struct {
+	ID          int        `json:"id"`
+	UserID      int        `json:"user_id"`
+	Status      string     `json:"status"`
+	FilePath    string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+}
+
+type ExportJobModel struct {
+	DB *sql.DB
+}
+
+// CountUserData returns how many posts, comments and messages a user has,
+// to tell small exports from the ones worth a background job
+func (em *ExportJobModel) CountUserData(userID int) (int, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM posts WHERE user_id = ?) +
+			(SELECT COUNT(*) FROM comments WHERE user_id = ?) +
+			(SELECT COUNT(*) FROM messages WHERE conversation_id IN (
+				SELECT id FROM conversations WHERE user1_id = ? OR user2_id = ?))
+	`
+	var count int
+	err := em.DB.QueryRow(query, userID, userID, userID, userID).Scan(&count)
+	return count, err
+}
+
+// InsertJob queues a new export for the user
+func (em *ExportJobModel) InsertJob(userID int) (ExportJob, error) {
+	job := ExportJob{UserID: userID, Status: ExportPending, CreatedAt: time.Now()}
+	res, err := em.DB.Exec(`INSERT INTO export_jobs (user_id, status, created_at) VALUES (?, ?, ?)`, job.UserID, job.Status, job.CreatedAt)
+	if err != nil {
+		return ExportJob{}, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return ExportJob{}, err
+	}
+	job.ID = int(id)
+	return job, nil
+}
+
+// CompleteJob marks an export as ready to download from filePath. It
+// returns sql.ErrNoRows if the job is gone, its account deleted meanwhile.
+func (em *ExportJobModel) CompleteJob(jobID int, filePath string) error {
+	res, err := em.DB.Exec(`UPDATE export_jobs SET status = ?, file_path = ?, completed_at = ? WHERE id = ?`,
+		ExportReady, filePath, time.Now(), jobID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FailJob records why an export couldn't be built
+func (em *ExportJobModel) FailJob(jobID int, reason string) error {
+	_, err := em.DB.Exec(`UPDATE export_jobs SET status = ?, error = ?, completed_at = ? WHERE id = ?`,
+		ExportFailed, reason, time.Now(), jobID)
+	return err
+}
+
+// FailStaleJobs marks exports still pending that were queued before
+// startedBefore as failed: their goroutine died with a restart or hung.
+// It returns how many it failed.
+func (em *ExportJobModel) FailStaleJobs(startedBefore time.Time) (int64, error) {
+	res, err := em.DB.Exec(`UPDATE export_jobs SET status = ?, error = ?, completed_at = ? WHERE status = ? AND created_at < ?`,
+		ExportFailed, "export was interrupted, please ask for a new one", time.Now(), ExportPending, startedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ExpireJobs deletes the jobs finished before completedBefore and returns
+// the archives they point to, for the caller to remove
+func (em *ExportJobModel) ExpireJobs(completedBefore time.Time) ([]string, error) {
+	rows, err := em.DB.Query(`DELETE FROM export_jobs WHERE status != ? AND completed_at < ? RETURNING file_path`,
+		ExportPending, completedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, err
+		}
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths, rows.Err()
+}
+
+// GetJob fetches one of the user's export jobs
+func (em *ExportJobModel) GetJob(userID, jobID int) (ExportJob, error) {
+	query := `
+		SELECT id, user_id, status, file_path, error, created_at, completed_at
+		FROM export_jobs
+		WHERE id = ? AND user_id = ?
+	`
+	return scanExportJob(em.DB.QueryRow(query, jobID, userID))
+}
+
+// GetPendingJob returns the user's export still being built, if any
+func (em *ExportJobModel) GetPendingJob(userID int) (ExportJob, error) {
+	query := `
+		SELECT id, user_id, status, file_path, error, created_at, completed_at
+		FROM export_jobs
+		WHERE user_id = ? AND status = ?
+		ORDER BY id DESC
+		LIMIT 1
+	`
+	return scanExportJob(em.DB.QueryRow(query, userID, ExportPending))
+}
+
+func scanExportJob(row rowScanner) (ExportJob, error) {
+	var job ExportJob
+	var completedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.UserID, &job.Status, &job.FilePath, &job.Error, &job.CreatedAt, &completedAt)
+	if err != nil {
+		return ExportJob{}, err
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	return job, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrSelfFollow = errors.New("you can't follow yourself")
+
+type FollowModel struct {
+	DB *sql.DB
+}
+
+// Follow makes followerID follow followeeID; following twice is a no-op
+func (fm *FollowModel) Follow(followerID, followeeID int) error {
+	if followerID == followeeID {
+		return ErrSelfFollow
+	}
+	_, err := fm.DB.Exec(`INSERT OR IGNORE INTO follows (follower_id, followee_id) VALUES (?, ?)`, followerID, followeeID)
+	return err
+}
+
+// Unfollow stops followerID following followeeID, returning sql.ErrNoRows if it didn't
+func (fm *FollowModel) Unfollow(followerID, followeeID int) error {
+	res, err := fm.DB.Exec(`DELETE FROM follows WHERE follower_id = ? AND followee_id = ?`, followerID, followeeID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// IsFollowing reports whether followerID follows followeeID
+func (fm *FollowModel) IsFollowing(followerID, followeeID int) (bool, error) {
+	var following bool
+	err := fm.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?)`,
+		followerID, followeeID).Scan(&following)
+	return following, err
+}
+
+// GetFollowers lists who follows userID, most recent first
+func (fm *FollowModel) GetFollowers(userID, offset, limit int) ([]UserSummary, error) {
+	query := `
+		SELECT u.id, u.username, u.first_name, u.last_name, u.profile_img
+		FROM follows f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.followee_id = ?
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT ? OFFSET ?
+	`
+	return fm.listUsers(query, userID, limit, offset)
+}
+
+// GetFollowing lists who userID follows, most recent first
+func (fm *FollowModel) GetFollowing(userID, offset, limit int) ([]UserSummary, error) {
+	query := `
+		SELECT u.id, u.username, u.first_name, u.last_name, u.profile_img
+		FROM follows f
+		JOIN users u ON u.id = f.followee_id
+		WHERE f.follower_id = ?
+		ORDER BY f.created_at DESC, u.id DESC
+		LIMIT ? OFFSET ?
+	`
+	return fm.listUsers(query, userID, limit, offset)
+}
+
+func (fm *FollowModel) listUsers(query string, args ...any) ([]UserSummary, error) {
+	rows, err := fm.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.ProfileImg); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
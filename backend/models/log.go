@@ -0,0 +1,146 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	LogInfo    = "INFO"
+	LogWarning = "WARNING"
+	LogError   = "ERROR"
+)
+
+// Security events recorded in the audit log
+const (
+	EventSignIn          = "signin"
+	EventSignInFailed    = "signin_failed"
+	EventSignInLocked    = "signin_locked"
+	EventSignInUnlocked  = "signin_unlocked"
+	EventSignOut         = "signout"
+	EventSessionRevoked  = "session_revoked"
+	EventRefreshReused   = "refresh_token_reused" // the token family was revoked
+	EventPasswordChanged = "password_changed"
+	EventRoleChanged     = "role_changed"
+	EventContentRemoved  = "content_removed" // by a moderator
+	EventContentRestored = "content_restored"
+	EventContentPurged   = "content_purged"
+)
+
+// logTimeLayout matches how SQLite's CURRENT_TIMESTAMP stores created_at
+const logTimeLayout = "2006-01-02 15:04:05"
+
+type Log struct {
+	ID        int           `json:"id"`
+	UserID    sql.NullInt64 `json:"user_id"`
+	Level     string        `json:"level"`
+	Origin    string        `json:"origin"`
+	Event     string        `json:"event"`
+	IP        string        `json:"ip"`
+	UserAgent string        `json:"user_agent"`
+	Message   string        `json:"message"`
+	CreatedAt time.Time     `json:"created_at"`
+}
+
+// LogFilter narrows down GetLogs, zero values matching everything
+type LogFilter struct {
+	UserID  int
+	Level   string
+	Origin  string
+	Event   string
+	IP      string
+	Since   time.Time
+	Until   time.Time
+	StartID int // newest first, from the entry before StartID (-1 for the latest)
+	NLog    int
+}
+
+type LogModel struct {
+	DB *sql.DB
+}
+
+// InsertLog writes an entry to the logs table
+func (lm *LogModel) InsertLog(entry Log) error {
+	query := `INSERT INTO logs (user_id, log_level, origin, event, ip, user_agent, message) VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := lm.DB.Exec(query, entry.UserID, entry.Level, entry.Origin, entry.Event, entry.IP, entry.UserAgent, entry.Message)
+	if err != nil {
+		return fmt.Errorf("failed to insert log: %w", err)
+	}
+	return nil
+}
+
+// GetLogs returns a page of log entries matching filter, newest first
+func (lm *LogModel) GetLogs(filter *LogFilter) ([]Log, error) {
+	if filter.StartID == -1 {
+		filter.StartID = math.MaxInt32
+	}
+
+	conditions := []string{"id < ?"}
+	args := []any{filter.StartID}
+	if filter.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Level != "" {
+		conditions = append(conditions, "log_level = ?")
+		args = append(args, filter.Level)
+	}
+	if filter.Origin != "" {
+		conditions = append(conditions, "origin = ?")
+		args = append(args, filter.Origin)
+	}
+	if filter.Event != "" {
+		conditions = append(conditions, "event = ?")
+		args = append(args, filter.Event)
+	}
+	if filter.IP != "" {
+		conditions = append(conditions, "ip = ?")
+		args = append(args, filter.IP)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC().Format(logTimeLayout))
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC().Format(logTimeLayout))
+	}
+
+	query := `
+		SELECT id, user_id, log_level, COALESCE(origin, ''), event, ip, user_agent, message, created_at
+		FROM logs
+		WHERE ` + strings.Join(conditions, " AND ") + `
+		ORDER BY id DESC
+		LIMIT ?`
+	args = append(args, filter.NLog)
+
+	rows, err := lm.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	logs := []Log{}
+	for rows.Next() {
+		var entry Log
+		err := rows.Scan(&entry.ID, &entry.UserID, &entry.Level, &entry.Origin, &entry.Event,
+			&entry.IP, &entry.UserAgent, &entry.Message, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, entry)
+	}
+	return logs, rows.Err()
+}
+
+// PruneLogs deletes the entries older than before and returns how many went
+func (lm *LogModel) PruneLogs(before time.Time) (int64, error) {
+	res, err := lm.DB.Exec(`DELETE FROM logs WHERE created_at < ?`, before.UTC().Format(logTimeLayout))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
@@ -0,0 +1,118 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+const (
+	// LoginIdentifierThreshold is how many wrong passwords an account takes before being locked
+	LoginIdentifierThreshold = 5
+	// LoginIPThreshold is how many failed sign ins a single client gets before being locked
+	LoginIPThreshold = 20
+
+	loginBaseLockout = 30 * time.Second
+	loginMaxLockout  = time.Hour
+	// loginFailureWindow is how long failures are remembered after the last one
+	loginFailureWindow = 24 * time.Hour
+)
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// LoginIdentifierKey is the attempts key of the email or username a sign in targets.
+// It doesn't depend on the account existing, so lockouts can't reveal it does.
+func LoginIdentifierKey(user *User) string {
+	identifier := strings.ToLower(strings.TrimSpace(user.Email))
+	if identifier == "" {
+		identifier = strings.ToLower(strings.TrimSpace(user.UserName))
+	}
+	return "identifier:" + identifier
+}
+
+// LoginAccountKeys are the attempts keys of every identifier an account can
+// sign in with, so a lockout holds whichever one the next attempt uses
+func LoginAccountKeys(user *User) []string {
+	return []string{
+		LoginIdentifierKey(&User{Email: user.Email}),
+		LoginIdentifierKey(&User{UserName: user.UserName}),
+	}
+}
+
+// LoginIPKey is the attempts key of a client address
+func LoginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// LockedFor returns how long the most restrictive of the given keys stays locked
+func (lam *LoginAttemptModel) LockedFor(keys ...string) (time.Duration, error) {
+	var longest time.Duration
+	now := time.Now()
+	for _, key := range keys {
+		var lockedUntil sql.NullTime
+		err := lam.DB.QueryRow(`SELECT locked_until FROM login_attempts WHERE key = ?`, key).Scan(&lockedUntil)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			return 0, err
+		}
+		if lockedUntil.Valid && lockedUntil.Time.Sub(now) > longest {
+			longest = lockedUntil.Time.Sub(now)
+		}
+	}
+	return longest, nil
+}
+
+// RecordFailure counts a failed attempt against key. Past threshold failures
+// the key gets locked, for twice as long with every further failure.
+// It returns the lockout just applied, or 0.
+func (lam *LoginAttemptModel) RecordFailure(key string, threshold int) (time.Duration, error) {
+	now := time.Now()
+
+	// counted in SQL so concurrent failures can't all read, and write back, the same count
+	var failures int
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at)
+		VALUES (?, 1, ?)
+		ON CONFLICT(key) DO UPDATE SET
+			failures = CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END,
+			last_failure_at = excluded.last_failure_at
+		RETURNING failures
+	`
+	err := lam.DB.QueryRow(query, key, now, now.Add(-loginFailureWindow)).Scan(&failures)
+	if err != nil {
+		return 0, err
+	}
+	if failures < threshold {
+		return 0, nil
+	}
+
+	lockout := loginBaseLockout << min(failures-threshold, 16)
+	if lockout > loginMaxLockout {
+		lockout = loginMaxLockout
+	}
+	// a failure counted since then has set a lockout at least as long
+	query = `UPDATE login_attempts SET locked_until = ? WHERE key = ? AND failures = ?`
+	if _, err := lam.DB.Exec(query, now.Add(lockout), key, failures); err != nil {
+		return 0, err
+	}
+	return lockout, nil
+}
+
+// Reset forgets the failures of key after a successful sign in.
+// It reports whether the key had been locked out.
+func (lam *LoginAttemptModel) Reset(key string) (bool, error) {
+	var lockedUntil sql.NullTime
+	err := lam.DB.QueryRow(`DELETE FROM login_attempts WHERE key = ? RETURNING locked_until`, key).Scan(&lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+	return lockedUntil.Valid, nil
+}
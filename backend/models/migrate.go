@@ -0,0 +1,203 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// migrations upgrade databases created from an older schema.sql, in order.
+// The database's PRAGMA user_version counts how many already ran; a fresh
+// schema.sql sets it to len(migrations) since it already has every change.
+var migrations = []string{
+	// 1: sessions moved from one row per user to one row per device, which
+	// SQLite can only do by rebuilding the table
+	`CREATE TABLE sessions_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		user_agent TEXT NOT NULL DEFAULT '',
+		ip TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	INSERT INTO sessions_new (user_id, token, expires_at) SELECT user_id, token, expires_at FROM sessions;
+	DROP TABLE sessions;
+	ALTER TABLE sessions_new RENAME TO sessions;
+	CREATE INDEX idx_sessions_user_id ON sessions(user_id);`,
+	// 2: account columns and the sign in tables (refresh tokens, API tokens,
+	// 2FA, lockouts, password resets)
+	`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('admin', 'moderator', 'member'));
+	ALTER TABLE users ADD COLUMN email_verified_at DATETIME DEFAULT NULL;
+	ALTER TABLE users ADD COLUMN totp_secret TEXT DEFAULT NULL;
+	ALTER TABLE users ADD COLUMN totp_enabled_at DATETIME DEFAULT NULL;
+	ALTER TABLE users ADD COLUMN totp_last_step INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN deleted_at DATETIME DEFAULT NULL;
+	ALTER TABLE users ADD COLUMN last_seen_at DATETIME DEFAULT NULL;
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		family TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		session_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME DEFAULT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (session_id) REFERENCES sessions(id) ON DELETE SET NULL
+	);
+	CREATE TABLE IF NOT EXISTS api_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		last_used_at DATETIME DEFAULT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS mfa_challenges (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		remember_me BOOLEAN NOT NULL DEFAULT 0,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at DATETIME DEFAULT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS login_attempts (
+		key TEXT PRIMARY KEY,
+		failures INTEGER NOT NULL DEFAULT 0,
+		last_failure_at DATETIME NOT NULL,
+		locked_until DATETIME DEFAULT NULL
+	);
+	CREATE TABLE IF NOT EXISTS password_resets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME DEFAULT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family ON refresh_tokens(family);
+	CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens(session_id);
+	CREATE INDEX IF NOT EXISTS idx_password_resets_user_id ON password_resets(user_id);
+	CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+	CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes(user_id);`,
+	// 3: post editing and moderation (revisions already handle posts that have
+	// none yet, see PostModel.UpdatePost)
+	`ALTER TABLE posts ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+	ALTER TABLE posts ADD COLUMN edited_at DATETIME DEFAULT NULL;
+	ALTER TABLE posts ADD COLUMN deleted_at DATETIME DEFAULT NULL;
+	ALTER TABLE posts ADD COLUMN deleted_by INTEGER DEFAULT NULL REFERENCES users(id) ON DELETE SET NULL;
+	ALTER TABLE posts ADD COLUMN delete_reason TEXT NOT NULL DEFAULT '';
+	ALTER TABLE comments ADD COLUMN deleted_at DATETIME DEFAULT NULL;
+	ALTER TABLE comments ADD COLUMN deleted_by INTEGER DEFAULT NULL REFERENCES users(id) ON DELETE SET NULL;
+	ALTER TABLE comments ADD COLUMN delete_reason TEXT NOT NULL DEFAULT '';
+	CREATE TABLE IF NOT EXISTS post_revisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		post_id INTEGER NOT NULL,
+		version INTEGER NOT NULL,
+		title TEXT NOT NULL,
+		content TEXT NOT NULL,
+		category_ids TEXT NOT NULL DEFAULT '[]',
+		editor_id INTEGER,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (post_id, version),
+		FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE,
+		FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE SET NULL
+	);`,
+	// 4: exports, follows, blocks, settings and the audit columns of logs
+	`CREATE TABLE IF NOT EXISTS export_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'ready', 'failed')),
+		file_path TEXT NOT NULL DEFAULT '',
+		error TEXT NOT NULL DEFAULT '',
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		completed_at DATETIME DEFAULT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS follows (
+		follower_id INTEGER NOT NULL,
+		followee_id INTEGER NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (follower_id, followee_id),
+		CHECK (follower_id != followee_id),
+		FOREIGN KEY (follower_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (followee_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS blocks (
+		blocker_id INTEGER NOT NULL,
+		blocked_id INTEGER NOT NULL,
+		kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (blocker_id, blocked_id),
+		CHECK (blocker_id != blocked_id),
+		FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+		FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	CREATE TABLE IF NOT EXISTS user_settings (
+		user_id INTEGER PRIMARY KEY,
+		version INTEGER NOT NULL,
+		data TEXT NOT NULL CHECK (json_valid(data)),
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);
+	ALTER TABLE logs ADD COLUMN event TEXT NOT NULL DEFAULT '';
+	ALTER TABLE logs ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+	ALTER TABLE logs ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+	CREATE INDEX IF NOT EXISTS idx_export_jobs_user_id ON export_jobs(user_id);
+	CREATE INDEX IF NOT EXISTS idx_follows_followee_id ON follows(followee_id);
+	CREATE INDEX IF NOT EXISTS idx_blocks_blocked_id ON blocks(blocked_id);
+	CREATE INDEX IF NOT EXISTS idx_logs_event ON logs(event);`,
+	// 5: accounts from before email verification can't verify anymore
+	`UPDATE users SET email_verified_at = COALESCE(created_at, CURRENT_TIMESTAMP) WHERE email_verified_at IS NULL`,
+	// 6: anonymized accounts were named deleted_<id>, a username anyone could
+	// sign up with, and nothing stopped two accounts sharing a username: the
+	// oldest account keeps it, the others become <username>-<id> (a '-' can't
+	// be picked at sign up) before the search index is rebuilt as unique
+	`UPDATE users SET username = 'deleted-' || id, email = 'deleted-' || id || '@deleted.invalid'
+		WHERE deleted_at IS NOT NULL;
+	UPDATE users SET username = username || '-' || id
+		WHERE id > (SELECT MIN(u.id) FROM users u WHERE u.username = users.username);
+	DROP INDEX IF EXISTS idx_users_username;
+	CREATE UNIQUE INDEX idx_users_username ON users(username);`,
+}
+
+// Migrate runs the migrations the database hasn't seen yet
+func Migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		// PRAGMA doesn't take bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Supported password hashing algorithms
+const (
+	HashArgon2id = "argon2id"
+	HashBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+var (
+	ErrUnknownHash     = errors.New("unknown password hash format")
+	ErrPasswordTooLong = errors.New("password is too long for bcrypt (72 bytes max)")
+	ErrInvalidHashAlgo = errors.New("password hash algorithm must be 'argon2id' or 'bcrypt'")
+)
+
+var passwordHashEncoder = base64.RawStdEncoding
+
+// Argon2Params are the argon2id cost settings (memory in KiB)
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies any hash it knows about. Hashes are self-describing (PHC string
+// for argon2id, modular crypt for bcrypt) so the settings can change over
+// time: stored hashes that don't match them get reported for a rehash.
+type PasswordHasher struct {
+	Algorithm  string
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// DefaultPasswordHasher uses argon2id with the OWASP recommended settings
+func DefaultPasswordHasher() *PasswordHasher {
+	return &PasswordHasher{
+		Algorithm:  HashArgon2id,
+		Argon2:     Argon2Params{Memory: 64 * 1024, Iterations: 3, Parallelism: 2},
+		BcryptCost: 12,
+	}
+}
+
+// Validate checks the hasher settings, to fail at startup rather than at sign up
+func (h *PasswordHasher) Validate() error {
+	switch h.Algorithm {
+	case HashArgon2id:
+		if h.Argon2.Memory < 8*uint32(h.Argon2.Parallelism) || h.Argon2.Iterations < 1 || h.Argon2.Parallelism < 1 {
+			return fmt.Errorf("invalid argon2id parameters: m=%d t=%d p=%d", h.Argon2.Memory, h.Argon2.Iterations, h.Argon2.Parallelism)
+		}
+	case HashBcrypt:
+		if h.BcryptCost < bcrypt.MinCost || h.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return ErrInvalidHashAlgo
+	}
+	return nil
+}
+
+// Accepts reports whether password can be hashed without losing part of it:
+// bcrypt silently ignores anything past 72 bytes
+func (h *PasswordHasher) Accepts(password string) error {
+	if h.Algorithm == HashBcrypt && len(password) > 72 {
+		return ErrPasswordTooLong
+	}
+	return nil
+}
+
+// Hash hashes password with the configured algorithm
+func (h *PasswordHasher) Hash(password string) ([]byte, error) {
+	if err := h.Accepts(password); err != nil {
+		return nil, err
+	}
+
+	switch h.Algorithm {
+	case HashBcrypt:
+		return bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+	case HashArgon2id:
+		salt := make([]byte, argon2SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("can't generate salt: %w", err)
+		}
+		p := h.Argon2
+		key := argon2.IDKey([]byte(password), salt, p.Iterations, p.Memory, p.Parallelism, argon2KeyLength)
+		encoded := fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+			passwordHashEncoder.EncodeToString(salt), passwordHashEncoder.EncodeToString(key))
+		return []byte(encoded), nil
+	default:
+		return nil, ErrInvalidHashAlgo
+	}
+}
+
+// Verify reports whether password matches hash, and whether the hash should
+// be replaced because it was made with another algorithm or other settings
+func (h *PasswordHasher) Verify(hash []byte, password string) (ok bool, rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(string(hash), "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(string(hash))
+		if err != nil {
+			return false, false, err
+		}
+		other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(key, other) != 1 {
+			return false, false, nil
+		}
+		return true, h.Algorithm != HashArgon2id || params != h.Argon2, nil
+
+	case strings.HasPrefix(string(hash), "$2"):
+		if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+			if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+				return false, false, nil
+			}
+			return false, false, err
+		}
+		cost, err := bcrypt.Cost(hash)
+		if err != nil {
+			return false, false, err
+		}
+		// hashes of passwords past 72 bytes only checked a prefix of them
+		return true, h.Algorithm != HashBcrypt || cost != h.BcryptCost || len(password) > 72, nil
+
+	default:
+		return false, false, ErrUnknownHash
+	}
+}
+
+// decodeArgon2id parses "$argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>"
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := passwordHashEncoder.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := passwordHashEncoder.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("invalid argon2 hash")
+	}
+	return params, salt, key, nil
+}
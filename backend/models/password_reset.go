@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PasswordResetTTL is how long a emailed reset link stays valid
+const PasswordResetTTL = time.Hour
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+type PasswordReset struct {
+	Email        string `json:"email"`
+	Token        string `json:"token"`
+	Password     string `json:"password"`
+	RepeatedPass string `json:"repeated_password"`
+}
+
+type PasswordResetModel struct {
+	DB *sql.DB
+}
+
+// CreateResetToken issues a new reset token for a user, invalidating any
+// earlier one still pending. Only the hash of the token is stored.
+func (prm *PasswordResetModel) CreateResetToken(userID int) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	_, err = prm.DB.Exec(`UPDATE password_resets SET used_at = ? WHERE user_id = ? AND used_at IS NULL`, now, userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to invalidate previous reset tokens: %w", err)
+	}
+
+	query := `INSERT INTO password_resets (user_id, token_hash, created_at, expires_at) VALUES (?, ?, ?, ?)`
+	if _, err := prm.DB.Exec(query, userID, hashToken(token), now, now.Add(PasswordResetTTL)); err != nil {
+		return "", fmt.Errorf("failed to insert reset token: %w", err)
+	}
+
+	return token, nil
+}
+
+// ResetPassword sets a new password from a reset token and returns the user
+// it belongs to, revoking their API tokens. The token is only used up if the
+// password is saved, so a failed attempt can be retried with the same link.
+func (um *UserModel) ResetPassword(token, password string) (int, error) {
+	hashedPwd, err := um.hashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := um.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	var userID int
+	query := `
+		UPDATE password_resets
+		SET used_at = ?
+		WHERE token_hash = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id
+	`
+	err = tx.QueryRow(query, now, hashToken(token), now).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrInvalidResetToken
+		}
+		return 0, err
+	}
+
+	if _, err := tx.Exec(`UPDATE users SET hashed_password = ? WHERE id = ?`, hashedPwd, userID); err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+	// API tokens go with the old password, or a stolen account's tokens would survive its recovery
+	if _, err := tx.Exec(`DELETE FROM api_tokens WHERE user_id = ?`, userID); err != nil {
+		return 0, fmt.Errorf("failed to revoke api tokens: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
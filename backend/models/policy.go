@@ -0,0 +1,259 @@
+package models
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Policy holds the rules for passwords, usernames and first/last names.
+// It's served as is on GET /policy so the signup form can show them.
+type Policy struct {
+	Password PasswordPolicy `json:"password"`
+	Username UsernamePolicy `json:"username"`
+	Name     NamePolicy     `json:"name"`
+}
+
+// Lengths are counted in characters, not bytes
+type PasswordPolicy struct {
+	MinLength      int    `json:"min_length"`
+	MaxLength      int    `json:"max_length"`
+	RequireUpper   bool   `json:"require_upper"`
+	RequireLower   bool   `json:"require_lower"`
+	RequireDigit   bool   `json:"require_digit"`
+	RequireSpecial bool   `json:"require_special"`
+	SpecialChars   string `json:"special_chars"`
+	RejectBreached bool   `json:"reject_breached"` // set by LoadBreachedPasswords
+
+	breached map[string]struct{} // uppercase SHA-1 hex digests
+}
+
+type UsernamePolicy struct {
+	MinLength    int      `json:"min_length"`
+	MaxLength    int      `json:"max_length"`
+	AllowUnicode bool     `json:"allow_unicode"` // letters and digits of any script, not only a-z 0-9
+	Reserved     []string `json:"reserved"`
+}
+
+type NamePolicy struct {
+	MinLength    int  `json:"min_length"`
+	MaxLength    int  `json:"max_length"`
+	AllowUnicode bool `json:"allow_unicode"` // letters of any script (and apostrophes), not only A-Z
+}
+
+// DefaultPolicy matches the rules echohub always had
+func DefaultPolicy() *Policy {
+	return &Policy{
+		Password: PasswordPolicy{
+			MinLength:      8,
+			MaxLength:      64,
+			RequireUpper:   true,
+			RequireLower:   true,
+			RequireDigit:   true,
+			RequireSpecial: true,
+			SpecialChars:   "!@#$%^&*()-_=+[]{}|;:',.<>?/",
+		},
+		Username: UsernamePolicy{
+			MinLength: 3,
+			MaxLength: 20,
+			Reserved:  []string{"admin", "administrator", "root", "system", "support", "moderator", "echohub", "me"},
+		},
+		Name: NamePolicy{
+			MinLength: 2,
+			MaxLength: 50,
+		},
+	}
+}
+
+// LoadPolicy reads a JSON policy file on top of DefaultPolicy, so the file
+// only needs the settings it changes. An empty path gives the defaults.
+func LoadPolicy(path string) (*Policy, error) {
+	policy := DefaultPolicy()
+	if path == "" {
+		return policy, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, policy); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+
+	for i, name := range policy.Username.Reserved {
+		policy.Username.Reserved[i] = strings.ToLower(strings.TrimSpace(name))
+	}
+	return policy, policy.validate()
+}
+
+func (p *Policy) validate() error {
+	ranges := map[string][2]int{
+		"password": {p.Password.MinLength, p.Password.MaxLength},
+		"username": {p.Username.MinLength, p.Username.MaxLength},
+		"name":     {p.Name.MinLength, p.Name.MaxLength},
+	}
+	for field, r := range ranges {
+		if r[0] < 1 || r[1] < r[0] {
+			return fmt.Errorf("invalid %s length range %d-%d", field, r[0], r[1])
+		}
+	}
+	if p.Password.RequireSpecial && p.Password.SpecialChars == "" {
+		return errors.New("special characters are required but none are allowed")
+	}
+	return nil
+}
+
+// LoadBreachedPasswords turns on the breached password check with a list of
+// known leaked passwords, one per line: either the password itself or its
+// SHA-1 hex digest (the "HASH:count" lines of Have I Been Pwned work as is)
+func (p *Policy) LoadBreachedPasswords(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if digest, _, _ := strings.Cut(line, ":"); isSHA1Hex(digest) {
+			breached[strings.ToUpper(digest)] = struct{}{}
+			continue
+		}
+		breached[sha1Hex(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.Password.breached = breached
+	p.Password.RejectBreached = true
+	return nil
+}
+
+// CheckPassword applies the password rules
+func (p *Policy) CheckPassword(password string) error {
+	rules := p.Password
+	if password == "" {
+		return errors.New("password is required")
+	}
+	if n := utf8.RuneCountInString(password); n < rules.MinLength || n > rules.MaxLength {
+		return fmt.Errorf("password length must be between %d and %d characters", rules.MinLength, rules.MaxLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSpecial bool
+	for _, c := range password {
+		switch {
+		case unicode.IsSpace(c):
+			return errors.New("password cannot contain spaces")
+		case unicode.IsUpper(c):
+			hasUpper = true
+		case unicode.IsLower(c):
+			hasLower = true
+		case unicode.IsDigit(c):
+			hasDigit = true
+		case strings.ContainsRune(rules.SpecialChars, c):
+			hasSpecial = true
+		}
+	}
+	if rules.RequireUpper && !hasUpper {
+		return errors.New("password must contain at least one uppercase letter")
+	}
+	if rules.RequireLower && !hasLower {
+		return errors.New("password must contain at least one lowercase letter")
+	}
+	if rules.RequireDigit && !hasDigit {
+		return errors.New("password must contain at least one digit")
+	}
+	if rules.RequireSpecial && !hasSpecial {
+		return fmt.Errorf("password must contain at least one of %s", rules.SpecialChars)
+	}
+
+	if rules.RejectBreached {
+		if _, found := rules.breached[sha1Hex(password)]; found {
+			return errors.New("this password appeared in a data breach, please choose another one")
+		}
+	}
+	return nil
+}
+
+// CheckUsername applies the username rules to a lowercased username
+// (uniqueness is left to the caller)
+func (p *Policy) CheckUsername(username string) error {
+	rules := p.Username
+	if username == "" {
+		return errors.New("username is required")
+	}
+	if n := utf8.RuneCountInString(username); n < rules.MinLength || n > rules.MaxLength {
+		return fmt.Errorf("username must be between %d and %d characters", rules.MinLength, rules.MaxLength)
+	}
+	if strings.HasPrefix(username, "_") || strings.HasSuffix(username, "_") {
+		return errors.New("username cannot start or end with '_'")
+	}
+	for _, c := range username {
+		ascii := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+		unicodeOK := rules.AllowUnicode && (unicode.IsLetter(c) || unicode.IsDigit(c))
+		if !ascii && !unicodeOK && c != '_' {
+			if rules.AllowUnicode {
+				return errors.New("username can only contain letters, numbers and underscores")
+			}
+			return errors.New("username can only contain latin letters, numbers and underscores")
+		}
+	}
+	if slices.Contains(rules.Reserved, username) {
+		return fmt.Errorf("'%s' is reserved", username)
+	}
+	return nil
+}
+
+// CheckName applies the rules for first and last names; label names the
+// field in error messages
+func (p *Policy) CheckName(label, name string) error {
+	rules := p.Name
+	name = strings.TrimSpace(name)
+	if n := utf8.RuneCountInString(name); n < rules.MinLength || n > rules.MaxLength {
+		return fmt.Errorf("%s must be between %d and %d characters", label, rules.MinLength, rules.MaxLength)
+	}
+	for _, c := range name {
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if rules.AllowUnicode && (unicode.IsLetter(c) || unicode.Is(unicode.Mn, c) || c == '\'' || c == '’') {
+			continue
+		}
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			continue
+		}
+		if rules.AllowUnicode {
+			return fmt.Errorf("%s can only contain letters, spaces, hyphens and apostrophes", label)
+		}
+		return fmt.Errorf("%s can only contain letters, spaces, and hyphens", label)
+	}
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func isSHA1Hex(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -10,14 +10,20 @@ import (
 )
 
 type Post struct {
-	ID         int        `json:"id"`
-	UserID     int        `json:"user_id"`
-	Username   string     `json:"username"`
-	UserImg    string     `json:"user_img"`
-	Title      string     `json:"title"`
-	Content    string     `json:"content"`
-	Categories []Category `json:"categories"` // category IDs
-	CreatedAt  time.Time  `json:"created_at"`
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Username     string     `json:"username"`
+	UserImg      string     `json:"user_img"`
+	Title        string     `json:"title"`
+	Content      string     `json:"content"`
+	Categories   []Category `json:"categories"` // category IDs
+	Version      int        `json:"version"`    // send it back when editing
+	Edited       bool       `json:"edited"`
+	EditedAt     *time.Time `json:"edited_at"`
+	Deleted      bool       `json:"deleted"` // title and content are RemovedPlaceholder in listings
+	DeletedAt    *time.Time `json:"deleted_at"`
+	DeleteReason string     `json:"delete_reason"`
+	CreatedAt    time.Time  `json:"created_at"`
 }
 
 type PostFilter struct {
@@ -25,20 +31,29 @@ type PostFilter struct {
 	StartID    int    `json:"start_id"`
 	NPost      int    `json:"n_post"`
 	CategoryID int    `json:"category_id"`
+	UserID     int    `json:"user_id"` // author for target "user", the caller when 0
 }
 
 type PostModel struct {
 	DB *sql.DB
 }
 
-// Insert Post
+var ErrEditConflict = errors.New("the post was edited since you loaded it, reload it and try again")
+
+// Insert Post, recording it as its first revision
 func (pm *PostModel) InsertPost(post Post) error {
+	tx, err := pm.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	postQuery := `
 		INSERT INTO posts (user_id, title, content)
 		VALUES (?, ?, ?)
 	`
 
-	res, err := pm.DB.Exec(postQuery, post.UserID, post.Title, post.Content)
+	res, err := tx.Exec(postQuery, post.UserID, post.Title, post.Content)
 	if err != nil {
 		return err
 	}
@@ -47,17 +62,93 @@ func (pm *PostModel) InsertPost(post Post) error {
 	if err != nil {
 		return err
 	}
+	post.ID = int(postID)
+	post.Version = 1
+
+	if err := setPostCategories(tx, post.ID, post.Categories); err != nil {
+		return err
+	}
+	if err := insertRevision(tx, post, post.UserID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdatePost replaces the title, content and categories of a validated
+// post, provided it's still at version expected: otherwise somebody edited
+// it in the meantime and ErrEditConflict is returned. The new version is
+// kept in post_revisions.
+func (pm *PostModel) UpdatePost(post Post, expected, editorID int) (Post, error) {
+	tx, err := pm.DB.Begin()
+	if err != nil {
+		return Post{}, err
+	}
+	defer tx.Rollback()
+
+	// posts from before revisions were kept have no row for their current version
+	_, err = tx.Exec(`
+		INSERT OR IGNORE INTO post_revisions (post_id, version, title, content, category_ids, editor_id, created_at)
+		SELECT p.id, p.version, p.title, p.content,
+		       (SELECT json_group_array(category_id) FROM post_categories WHERE post_id = p.id),
+		       p.user_id, COALESCE(p.edited_at, p.created_at)
+		FROM posts p WHERE p.id = ?
+	`, post.ID)
+	if err != nil {
+		return Post{}, err
+	}
+
+	now := time.Now().UTC()
+	res, err := tx.Exec(`
+		UPDATE posts SET title = ?, content = ?, version = version + 1, edited_at = ?
+		WHERE id = ? AND version = ?
+	`, post.Title, post.Content, now, post.ID, expected)
+	if err != nil {
+		return Post{}, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return Post{}, err
+	}
+	if affected == 0 {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM posts WHERE id = ?)`, post.ID).Scan(&exists); err != nil {
+			return Post{}, err
+		}
+		if !exists {
+			return Post{}, sql.ErrNoRows
+		}
+		return Post{}, ErrEditConflict
+	}
+
+	if _, err := tx.Exec(`DELETE FROM post_categories WHERE post_id = ?`, post.ID); err != nil {
+		return Post{}, err
+	}
+	if err := setPostCategories(tx, post.ID, post.Categories); err != nil {
+		return Post{}, err
+	}
+
+	post.Version = expected + 1
+	if err := insertRevision(tx, post, editorID); err != nil {
+		return Post{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Post{}, err
+	}
+
+	return pm.GetPostByID(post.ID)
+}
 
+func setPostCategories(tx *sql.Tx, postID int, categories []Category) error {
 	catQuery := `
 		INSERT OR IGNORE INTO post_categories (post_id, category_id)
 		VALUES (?, ?)
 	`
-	for _, cat := range post.Categories {
-		if _, err := pm.DB.Exec(catQuery, postID, cat.ID); err != nil {
+	for _, cat := range categories {
+		if _, err := tx.Exec(catQuery, postID, cat.ID); err != nil {
 			return err
 		}
 	}
-
 	return nil
 }
 
@@ -67,34 +158,25 @@ func ValidatePost(post *Post) error {
 	}
 
 	post.Title = strings.TrimSpace(post.Title)
-	if post.Title == "" {
-		return errors.New("post.Title cannot be empty or whitespace")
-	}
-	if len(post.Title) > 70 {
-		return errors.New("post.Title must be at most 70 characters long")
-	}
-
 	post.Content = strings.TrimSpace(post.Content)
-	if post.Content == "" {
-		return errors.New("post.Content cannot be empty or whitespace")
-	}
-	if len(post.Content) > 1000 {
-		return errors.New("post.Content must be at most 1000 characters long")
-	}
 
-	categoryCount := len(post.Categories)
-	if categoryCount < 1 || categoryCount > 3 {
-		return errors.New("post must have between 1 and 3 categories")
+	var categoriesErr error
+	if categoryCount := len(post.Categories); categoryCount < 1 || categoryCount > 3 {
+		categoriesErr = errors.New("post must have between 1 and 3 categories")
 	}
 
-	return nil
+	return fieldErrors(map[string]error{
+		"title":      textCheck("title", post.Title, 70),
+		"content":    textCheck("content", post.Content, 1000),
+		"categories": categoriesErr,
+	})
 }
 
 // GetPostByID gets post and its author info
 func (pm *PostModel) GetPostByID(id int) (Post, error) {
 	postQuery := `
 		SELECT 
-			p.id, p.user_id, p.title, p.content, p.created_at,
+			p.id, p.user_id, p.title, p.content, p.version, p.edited_at, p.deleted_at, p.delete_reason, p.created_at,
 			u.username, u.profile_img
 		FROM posts p
 		JOIN users u ON p.user_id = u.id
@@ -107,17 +189,24 @@ func (pm *PostModel) GetPostByID(id int) (Post, error) {
 		&post.UserID,
 		&post.Title,
 		&post.Content,
+		&post.Version,
+		&post.EditedAt,
+		&post.DeletedAt,
+		&post.DeleteReason,
 		&post.CreatedAt,
 		&post.Username,
 		&post.UserImg,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return Post{}, fmt.Errorf("post with id %d not found", id)
+			return Post{}, fmt.Errorf("post with id %d not found: %w", id, err)
 		}
 		return Post{}, fmt.Errorf("failed to get post [%d]: %w", id, err)
 	}
 
+	post.Edited = post.EditedAt != nil
+	post.Deleted = post.DeletedAt != nil
+
 	post.Categories, err = pm.GetPostCategoriesByPostID(post.ID)
 	if err != nil {
 		return Post{}, fmt.Errorf("failed to get categories for post %d: %w", post.ID, err)
@@ -141,7 +230,10 @@ func (pm *PostModel) GetLastPostID() (int, error) {
 	return lastID, nil
 }
 
-// FilterPosts supports filtering by feed (all), category (via join), or user posts with pagination
+// FilterPosts supports filtering by feed (all), category (via join), user posts, or posts of
+// the users the caller follows, with pagination.
+// userID is the caller, whose posts "user" lists unless filter.UserID names another author.
+// Posts by users the caller blocked or muted are left out.
 func (pm *PostModel) FilterPosts(filter *PostFilter, userID int) ([]Post, error, int) {
 	var query string
 	var args []any
@@ -158,43 +250,60 @@ func (pm *PostModel) FilterPosts(filter *PostFilter, userID int) ([]Post, error,
 	switch filter.Target {
 	case "feed":
 		query = `
-			SELECT p.id, p.user_id, p.title, p.content, p.created_at,
+			SELECT p.id, p.user_id, p.title, p.content, p.version, p.edited_at, p.deleted_at, p.delete_reason, p.created_at,
 			       u.username, u.profile_img
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
-			WHERE p.id < ?
+			WHERE p.id < ? AND p.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)
 			ORDER BY p.id DESC
 			LIMIT ?
 		`
-		args = append(args, filter.StartID, filter.NPost)
+		args = append(args, filter.StartID, userID, filter.NPost)
 
 	case "category":
 		query = `
-			SELECT p.id, p.user_id, p.title, p.content, p.created_at,
+			SELECT p.id, p.user_id, p.title, p.content, p.version, p.edited_at, p.deleted_at, p.delete_reason, p.created_at,
 			       u.username, u.profile_img
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
 			JOIN post_categories pc ON p.id = pc.post_id
-			WHERE pc.category_id = ? AND p.id < ?
+			WHERE pc.category_id = ? AND p.id < ? AND p.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)
 			ORDER BY p.id DESC
 			LIMIT ?
 		`
-		args = append(args, filter.CategoryID, filter.StartID, filter.NPost)
+		args = append(args, filter.CategoryID, filter.StartID, userID, filter.NPost)
 
 	case "user":
 		query = `
-			SELECT p.id, p.user_id, p.title, p.content, p.created_at,
+			SELECT p.id, p.user_id, p.title, p.content, p.version, p.edited_at, p.deleted_at, p.delete_reason, p.created_at,
 			       u.username, u.profile_img
 			FROM posts p
 			JOIN users u ON p.user_id = u.id
-			WHERE p.user_id = ? AND p.id < ?
+			WHERE p.user_id = ? AND p.id < ? AND p.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)
 			ORDER BY p.id DESC
 			LIMIT ?
 		`
-		args = append(args, userID, filter.StartID, filter.NPost)
+		authorID := userID
+		if filter.UserID != 0 {
+			authorID = filter.UserID
+		}
+		args = append(args, authorID, filter.StartID, userID, filter.NPost)
+
+	case "following":
+		query = `
+			SELECT p.id, p.user_id, p.title, p.content, p.version, p.edited_at, p.deleted_at, p.delete_reason, p.created_at,
+			       u.username, u.profile_img
+			FROM posts p
+			JOIN users u ON p.user_id = u.id
+			JOIN follows f ON f.followee_id = p.user_id
+			WHERE f.follower_id = ? AND p.id < ? AND p.user_id NOT IN (SELECT blocked_id FROM blocks WHERE blocker_id = ?)
+			ORDER BY p.id DESC
+			LIMIT ?
+		`
+		args = append(args, userID, filter.StartID, userID, filter.NPost)
 
 	default:
-		return nil, errors.New("invalid target: must be 'feed', 'category' or 'user'"), http.StatusBadRequest
+		return nil, errors.New("invalid target: must be 'feed', 'category', 'user' or 'following'"), http.StatusBadRequest
 	}
 
 	rows, err := pm.DB.Query(query, args...)
@@ -211,6 +320,10 @@ func (pm *PostModel) FilterPosts(filter *PostFilter, userID int) ([]Post, error,
 			&post.UserID,
 			&post.Title,
 			&post.Content,
+			&post.Version,
+			&post.EditedAt,
+			&post.DeletedAt,
+			&post.DeleteReason,
 			&post.CreatedAt,
 			&post.Username,
 			&post.UserImg,
@@ -219,6 +332,12 @@ func (pm *PostModel) FilterPosts(filter *PostFilter, userID int) ([]Post, error,
 			return nil, fmt.Errorf("error scanning post: %w", err), http.StatusInternalServerError
 		}
 
+		post.Edited = post.EditedAt != nil
+		post.Deleted = post.DeletedAt != nil
+		if post.Deleted {
+			post.Title, post.Content = RemovedPlaceholder, RemovedPlaceholder
+		}
+
 		// Load categories
 		post.Categories, err = pm.GetPostCategoriesByPostID(post.ID)
 		if err != nil {
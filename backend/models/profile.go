@@ -0,0 +1,140 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Profile is what anybody signed in can see of a member
+type Profile struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	FirstName    string    `json:"first_name"`
+	LastName     string    `json:"last_name"`
+	ProfileImg   string    `json:"profile_img"`
+	Role         string    `json:"role"`
+	JoinedAt     time.Time `json:"joined_at"`
+	PostCount    int       `json:"post_count"`
+	CommentCount int       `json:"comment_count"`
+	Followers    int       `json:"followers"`
+	Following    int       `json:"following"`
+	IsFollowed   bool      `json:"is_followed"` // whether the viewer follows them
+	Posts        []Post    `json:"posts"`
+}
+
+// GetProfile looks up the public profile of a member by username, with
+// their post, comment and follow counts. Closed accounts are not found.
+func (um *UserModel) GetProfile(username string) (*Profile, error) {
+	query := `
+		SELECT
+			u.id, u.username, u.first_name, u.last_name, u.profile_img, u.role, u.created_at,
+			(SELECT COUNT(*) FROM posts WHERE user_id = u.id AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM comments WHERE user_id = u.id AND deleted_at IS NULL),
+			(SELECT COUNT(*) FROM follows WHERE followee_id = u.id),
+			(SELECT COUNT(*) FROM follows WHERE follower_id = u.id)
+		FROM users u
+		WHERE u.username = ? AND u.deleted_at IS NULL
+	`
+	profile := &Profile{}
+	err := um.DB.QueryRow(query, strings.ToLower(strings.TrimSpace(username))).Scan(
+		&profile.ID,
+		&profile.Username,
+		&profile.FirstName,
+		&profile.LastName,
+		&profile.ProfileImg,
+		&profile.Role,
+		&profile.JoinedAt,
+		&profile.PostCount,
+		&profile.CommentCount,
+		&profile.Followers,
+		&profile.Following,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// GetUserIDByUsername resolves the username of an open account
+func (um *UserModel) GetUserIDByUsername(username string) (int, error) {
+	var userID int
+	err := um.DB.QueryRow(`SELECT id FROM users WHERE username = ? AND deleted_at IS NULL`,
+		strings.ToLower(strings.TrimSpace(username))).Scan(&userID)
+	return userID, err
+}
+
+// UserSummary is the short public view of a member used in lists
+type UserSummary struct {
+	ID         int    `json:"id"`
+	Username   string `json:"username"`
+	FirstName  string `json:"first_name"`
+	LastName   string `json:"last_name"`
+	ProfileImg string `json:"profile_img"`
+}
+
+// SearchUsers finds members whose username or name matches query, best
+// matches first: exact username, username prefix (an index range scan on
+// idx_users_username), first/last/full name prefix, then usernames holding
+// the query's letters in order ("alc" finds "alice"). excludeID (the
+// searcher) is left out of the results.
+func (um *UserModel) SearchUsers(query string, excludeID, offset, limit int) ([]UserSummary, error) {
+	query = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(query), "@"))
+	if query == "" {
+		return []UserSummary{}, nil
+	}
+
+	escaped := escapeLike(query)
+	var fuzzy strings.Builder
+	fuzzy.WriteString("%")
+	for _, c := range query {
+		fuzzy.WriteString(escapeLike(string(c)) + "%")
+	}
+
+	sqlQuery := `
+		SELECT id, username, first_name, last_name, profile_img
+		FROM (
+			SELECT id, username, first_name, last_name, profile_img, deleted_at,
+			       CASE WHEN username = ? THEN 0 ELSE 1 END AS rank
+			FROM users
+			WHERE username >= ? AND username < ?
+			UNION ALL
+			SELECT id, username, first_name, last_name, profile_img, deleted_at, 2
+			FROM users
+			WHERE first_name LIKE ? ESCAPE '\' OR last_name LIKE ? ESCAPE '\'
+			   OR (first_name || ' ' || last_name) LIKE ? ESCAPE '\'
+			UNION ALL
+			SELECT id, username, first_name, last_name, profile_img, deleted_at, 3
+			FROM users
+			WHERE username LIKE ? ESCAPE '\'
+		)
+		WHERE deleted_at IS NULL AND id != ?
+		GROUP BY id
+		ORDER BY MIN(rank), length(username), username
+		LIMIT ? OFFSET ?
+	`
+	rows, err := um.DB.Query(sqlQuery,
+		query, query, query+"\U0010FFFF",
+		escaped+"%", escaped+"%", escaped+"%",
+		fuzzy.String(),
+		excludeID, limit, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []UserSummary{}
+	for rows.Next() {
+		var user UserSummary
+		if err := rows.Scan(&user.ID, &user.Username, &user.FirstName, &user.LastName, &user.ProfileImg); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// escapeLike escapes the LIKE wildcards of s, for patterns using ESCAPE '\'
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RemovedPlaceholder replaces the title and content of soft deleted posts
+// and comments, which stay in listings so threads keep their shape
+const RemovedPlaceholder = "[removed]"
+
+const maxDeleteReason = 200
+
+var (
+	ErrAlreadyRemoved = errors.New("this was already removed")
+	ErrNotRemoved     = errors.New("only removed content can be restored or purged")
+)
+
+// Removal is the optional body of a post or comment deletion
+type Removal struct {
+	Reason string `json:"reason"`
+}
+
+func ValidateRemoval(removal *Removal) error {
+	removal.Reason = strings.TrimSpace(removal.Reason)
+	if len(removal.Reason) > maxDeleteReason {
+		return fieldError("reason", fmt.Errorf("reason must be at most %d characters long", maxDeleteReason))
+	}
+	return nil
+}
+
+// softDelete marks a row of posts or comments as removed by deletedBy
+func softDelete(db *sql.DB, table string, id, deletedBy int, reason string) error {
+	res, err := db.Exec(`UPDATE `+table+` SET deleted_at = ?, deleted_by = ?, delete_reason = ?
+		WHERE id = ? AND deleted_at IS NULL`, time.Now().UTC(), deletedBy, reason, id)
+	return removalResult(db, table, id, res, err, ErrAlreadyRemoved)
+}
+
+// restore brings back a soft deleted row of posts or comments
+func restore(db *sql.DB, table string, id int) error {
+	res, err := db.Exec(`UPDATE `+table+` SET deleted_at = NULL, deleted_by = NULL, delete_reason = ''
+		WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	return removalResult(db, table, id, res, err, ErrNotRemoved)
+}
+
+// purge deletes a soft deleted row of posts or comments for good, along
+// with what cascades from it
+func purge(db *sql.DB, table string, id int) error {
+	res, err := db.Exec(`DELETE FROM `+table+` WHERE id = ? AND deleted_at IS NOT NULL`, id)
+	return removalResult(db, table, id, res, err, ErrNotRemoved)
+}
+
+// removalResult tells why a removal statement changed nothing: either the
+// row doesn't exist (sql.ErrNoRows) or it isn't in the expected state
+func removalResult(db *sql.DB, table string, id int, res sql.Result, err error, stateErr error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return stateErr
+}
+
+// DeletePost soft deletes a post
+func (pm *PostModel) DeletePost(postID, deletedBy int, reason string) error {
+	return softDelete(pm.DB, "posts", postID, deletedBy, reason)
+}
+
+// RestorePost undoes DeletePost
+func (pm *PostModel) RestorePost(postID int) error {
+	return restore(pm.DB, "posts", postID)
+}
+
+// PurgePost deletes a removed post for good, with its comments and revisions
+func (pm *PostModel) PurgePost(postID int) error {
+	return purge(pm.DB, "posts", postID)
+}
+
+// RestoreComment undoes DeleteComment
+func (cm *CommentModel) RestoreComment(commentID int) error {
+	return restore(cm.DB, "comments", commentID)
+}
+
+// PurgeComment deletes a removed comment for good
+func (cm *CommentModel) PurgeComment(commentID int) error {
+	return purge(cm.DB, "comments", commentID)
+}
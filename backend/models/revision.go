@@ -0,0 +1,164 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"regexp"
+	"slices"
+	"time"
+)
+
+// PostRevision is one version of a post as it was saved
+type PostRevision struct {
+	Version     int       `json:"version"`
+	Title       string    `json:"title"`
+	Content     string    `json:"content"`
+	CategoryIDs []int     `json:"category_ids"`
+	EditorID    *int      `json:"editor_id"` // nil once the editor's account is deleted
+	Editor      string    `json:"editor"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// RevisionDiff tells what changed between two versions of a post
+type RevisionDiff struct {
+	From              int           `json:"from"`
+	To                int           `json:"to"`
+	Title             []DiffSegment `json:"title"`
+	Content           []DiffSegment `json:"content"`
+	AddedCategories   []int         `json:"added_categories"`
+	RemovedCategories []int         `json:"removed_categories"`
+}
+
+// DiffSegment is a run of text kept, inserted or deleted
+type DiffSegment struct {
+	Op   string `json:"op"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+func insertRevision(tx *sql.Tx, post Post, editorID int) error {
+	ids := make([]int, len(post.Categories))
+	for i, cat := range post.Categories {
+		ids[i] = cat.ID
+	}
+	categoryIDs, err := json.Marshal(ids)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO post_revisions (post_id, version, title, content, category_ids, editor_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, post.ID, post.Version, post.Title, post.Content, string(categoryIDs), editorID)
+	return err
+}
+
+// GetRevisions lists every saved version of a post, oldest first
+func (pm *PostModel) GetRevisions(postID int) ([]PostRevision, error) {
+	rows, err := pm.DB.Query(`
+		SELECT r.version, r.title, r.content, r.category_ids, r.editor_id, COALESCE(u.username, ''), r.created_at
+		FROM post_revisions r
+		LEFT JOIN users u ON u.id = r.editor_id
+		WHERE r.post_id = ?
+		ORDER BY r.version
+	`, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var revision PostRevision
+		var categoryIDs string
+		err := rows.Scan(&revision.Version, &revision.Title, &revision.Content, &categoryIDs,
+			&revision.EditorID, &revision.Editor, &revision.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(categoryIDs), &revision.CategoryIDs); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// DiffRevisions compares two revisions word by word
+func DiffRevisions(from, to PostRevision) RevisionDiff {
+	diff := RevisionDiff{
+		From:              from.Version,
+		To:                to.Version,
+		Title:             diffWords(from.Title, to.Title),
+		Content:           diffWords(from.Content, to.Content),
+		AddedCategories:   []int{},
+		RemovedCategories: []int{},
+	}
+	for _, id := range to.CategoryIDs {
+		if !slices.Contains(from.CategoryIDs, id) {
+			diff.AddedCategories = append(diff.AddedCategories, id)
+		}
+	}
+	for _, id := range from.CategoryIDs {
+		if !slices.Contains(to.CategoryIDs, id) {
+			diff.RemovedCategories = append(diff.RemovedCategories, id)
+		}
+	}
+	return diff
+}
+
+var diffTokens = regexp.MustCompile(`\s+|[\p{L}\p{N}_]+|[^\s\p{L}\p{N}_]`)
+
+// diffWords diffs two texts split into words, punctuation and runs of
+// whitespace, using their longest common subsequence. Posts are short
+// enough for the quadratic table.
+func diffWords(a, b string) []DiffSegment {
+	x := diffTokens.FindAllString(a, -1)
+	y := diffTokens.FindAllString(b, -1)
+
+	// lcs[i][j] is the length of the LCS of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	segments := []DiffSegment{}
+	add := func(op, text string) {
+		if n := len(segments); n > 0 && segments[n-1].Op == op {
+			segments[n-1].Text += text
+			return
+		}
+		segments = append(segments, DiffSegment{Op: op, Text: text})
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			add("equal", x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add("delete", x[i])
+			i++
+		default:
+			add("insert", y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		add("delete", x[i])
+	}
+	for ; j < len(y); j++ {
+		add("insert", y[j])
+	}
+	return segments
+}
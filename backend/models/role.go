@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"slices"
+)
+
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+)
+
+// Permission is what a route requires from the signed in user
+type Permission string
+
+const (
+	PermAccount          Permission = "account"           // manage one's own account, sessions and tokens
+	PermRead             Permission = "read"              // browse posts, comments and categories
+	PermPost             Permission = "post"              // create posts
+	PermComment          Permission = "comment"           // create and delete one's own comments
+	PermChat             Permission = "chat"              // private messages
+	PermModerate         Permission = "moderate"          // remove anybody's content
+	PermManageCategories Permission = "manage_categories" // create, edit and delete categories
+	PermManageRoles      Permission = "manage_roles"      // promote and demote users
+	PermViewAuditLog     Permission = "view_audit_log"    // read the security audit log
+)
+
+var ErrInvalidRole = errors.New("role must be 'admin', 'moderator' or 'member'")
+
+var memberPermissions = []Permission{PermAccount, PermRead, PermPost, PermComment, PermChat}
+
+var rolePermissions = map[string][]Permission{
+	RoleMember:    memberPermissions,
+	RoleModerator: append(slices.Clone(memberPermissions), PermModerate),
+	RoleAdmin:     append(slices.Clone(memberPermissions), PermModerate, PermManageCategories, PermManageRoles, PermViewAuditLog),
+}
+
+// Can reports whether the user's role grants permission
+func (u *User) Can(permission Permission) bool {
+	return slices.Contains(rolePermissions[u.Role], permission)
+}
+
+// TokenScope is the API token scope that unlocks a permission, empty when
+// the permission is out of reach of API tokens
+func (p Permission) TokenScope() string {
+	switch p {
+	case PermRead:
+		return ScopeRead
+	case PermPost, PermComment:
+		return ScopeWrite
+	case PermChat:
+		return ScopeChat
+	default:
+		return ""
+	}
+}
+
+func ValidateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return fieldError("role", ErrInvalidRole)
+	}
+	return nil
+}
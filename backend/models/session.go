@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
@@ -10,38 +11,100 @@ import (
 )
 
 // insert session
-// update session
+// touch (slide) session
 // delete session
 // select session
-// select all user session
+// select all user sessions
+// issue / rotate refresh token
+// create / consume 2FA challenge
+
+const (
+	// SessionTTL is how long a session survives without any activity
+	SessionTTL = 24 * time.Hour
+	// RefreshTokenTTL is how long a "remember me" sign-in lasts
+	RefreshTokenTTL = 30 * 24 * time.Hour
+	// RefreshReuseGrace is how long a rotated refresh token is still tolerated,
+	// so two tabs refreshing at once don't look like a stolen token
+	RefreshReuseGrace = 30 * time.Second
+	// sessionTouchInterval limits how often activity is written back to the DB
+	sessionTouchInterval = time.Minute
+	// MFAChallengeTTL is how long a user has to type their 2FA code after the password
+	MFAChallengeTTL = 5 * time.Minute
+	// mfaChallengeAttempts is how many wrong codes a challenge survives
+	mfaChallengeAttempts = 5
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrRefreshTokenRotated = errors.New("refresh token was just rotated, retry with the new one")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired sign in challenge")
+)
 
 type Session struct {
+	ID         int       `json:"id"`
+	Token      string    `json:"-"`
+	UserID     int       `json:"user_id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type RefreshToken struct {
 	Token     string
 	UserID    int
+	Family    string
+	SessionID int
 	ExpiresAt time.Time
 }
 
+// MFAChallenge is the half-finished sign in of a 2FA account
+type MFAChallenge struct {
+	ID         int
+	UserID     int
+	RememberMe bool
+}
+
 type SessionModel struct {
 	DB *sql.DB
 }
 
-func (sm *SessionModel) GenerateNewSession(userID int) (Session, error) {
-	exp := 24 * time.Hour
+func (sm *SessionModel) GenerateNewSession(userID int, userAgent, ip string) (Session, error) {
 	newToken, err := uuid.NewRandom()
 	if err != nil {
 		return Session{}, fmt.Errorf("can't generate session")
 	}
 
+	now := time.Now()
 	return Session{
-		UserID:    userID,
-		Token:     newToken.String(),
-		ExpiresAt: time.Now().Add(exp),
+		UserID:     userID,
+		Token:      newToken.String(),
+		UserAgent:  userAgent,
+		IP:         ip,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(SessionTTL),
 	}, nil
 }
 
 func (sm *SessionModel) GetUserBySession(Token string) (session Session, errCode int, err error) {
-	query := `SELECT token, user_id, expires_at FROM sessions WHERE token = ?`
-	err = sm.DB.QueryRow(query, Token).Scan(&session.Token, &session.UserID, &session.ExpiresAt)
+	query := `
+		SELECT id, token, user_id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE token = ?`
+	err = sm.DB.QueryRow(query, Token).Scan(
+		&session.ID,
+		&session.Token,
+		&session.UserID,
+		&session.UserAgent,
+		&session.IP,
+		&session.CreatedAt,
+		&session.LastSeenAt,
+		&session.ExpiresAt,
+	)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return Session{}, http.StatusUnauthorized, fmt.Errorf("session not found: %v", err)
@@ -56,34 +119,349 @@ func (sm *SessionModel) GetUserBySession(Token string) (session Session, errCode
 	return session, http.StatusOK, nil
 }
 
-func (sm *SessionModel) UpSertSession(newSession Session) (http.Cookie, error) {
+// InsertSession stores a new device session next to the user's other ones
+// and returns the cookie carrying its token.
+func (sm *SessionModel) InsertSession(newSession *Session) (http.Cookie, error) {
 	query := `
-		INSERT INTO sessions (user_id, token, expires_at)
-		VALUES (?, ?, ?)
-		ON CONFLICT(user_id)
-		DO UPDATE SET
-			token = excluded.token,
-			expires_at = excluded.expires_at;
+		INSERT INTO sessions (user_id, token, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
 	`
 
-	_, err := sm.DB.Exec(query, newSession.UserID, newSession.Token, newSession.ExpiresAt)
+	res, err := sm.DB.Exec(query,
+		newSession.UserID,
+		newSession.Token,
+		newSession.UserAgent,
+		newSession.IP,
+		newSession.CreatedAt,
+		newSession.LastSeenAt,
+		newSession.ExpiresAt,
+	)
+	if err != nil {
+		return http.Cookie{}, fmt.Errorf("failed to insert session: %v", err)
+	}
+
+	id, err := res.LastInsertId()
 	if err != nil {
-		return http.Cookie{}, fmt.Errorf("session not found: %v", err)
+		return http.Cookie{}, fmt.Errorf("failed to insert session: %v", err)
 	}
+	newSession.ID = int(id)
 
-	cookie := http.Cookie{
+	return SessionCookie(*newSession), nil
+}
+
+// SessionCookie builds the session_id cookie for a session
+func SessionCookie(session Session) http.Cookie {
+	return http.Cookie{
 		Name:     "session_id",
-		Value:    newSession.Token,
+		Value:    session.Token,
 		Path:     "/",
 		HttpOnly: true,
 		SameSite: http.SameSiteLaxMode,
-		Expires:  newSession.ExpiresAt,
+		Expires:  session.ExpiresAt,
+	}
+}
+
+// TouchSession records activity on a session and slides its expiry forward.
+// It reports whether the session was renewed so the caller can refresh the cookie.
+func (sm *SessionModel) TouchSession(session *Session, ip string) (bool, error) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < sessionTouchInterval && session.IP == ip {
+		return false, nil
+	}
+
+	session.LastSeenAt = now
+	session.IP = ip
+	session.ExpiresAt = now.Add(SessionTTL)
+
+	_, err := sm.DB.Exec(`UPDATE sessions SET last_seen_at = ?, ip = ?, expires_at = ? WHERE id = ?`,
+		session.LastSeenAt, session.IP, session.ExpiresAt, session.ID)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetUserSessions lists every active session of a user, most recently used first
+func (sm *SessionModel) GetUserSessions(userID int) ([]Session, error) {
+	query := `
+		SELECT id, user_id, user_agent, ip, created_at, last_seen_at, expires_at
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC
+	`
+	rows, err := sm.DB.Query(query, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IP,
+			&session.CreatedAt,
+			&session.LastSeenAt,
+			&session.ExpiresAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
 	}
 
-	return cookie, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteSession removes a single session by its token (sign out of this device)
+// along with the refresh token family that keeps it alive.
+func (sm *SessionModel) DeleteSession(Token string) error {
+	_, err := sm.DB.Exec(`
+		DELETE FROM refresh_tokens
+		WHERE family IN (
+			SELECT rt.family FROM refresh_tokens rt
+			JOIN sessions s ON s.id = rt.session_id
+			WHERE s.token = ?
+		)`, Token)
+	if err != nil {
+		return err
+	}
+	_, err = sm.DB.Exec(`DELETE FROM sessions WHERE token = ?`, Token)
+	return err
+}
+
+// DeleteUserSession revokes one of the user's sessions by ID
+func (sm *SessionModel) DeleteUserSession(userID, sessionID int) error {
+	_, err := sm.DB.Exec(`
+		DELETE FROM refresh_tokens
+		WHERE user_id = ? AND family IN (SELECT family FROM refresh_tokens WHERE session_id = ?)`,
+		userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	res, err := sm.DB.Exec(`DELETE FROM sessions WHERE id = ? AND user_id = ?`, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteUserSessions revokes every session of a user except the one with exceptID (0 keeps none)
+func (sm *SessionModel) DeleteUserSessions(userID, exceptID int) error {
+	_, err := sm.DB.Exec(`
+		DELETE FROM refresh_tokens
+		WHERE user_id = ? AND family NOT IN (SELECT family FROM refresh_tokens WHERE session_id = ?)`,
+		userID, exceptID)
+	if err != nil {
+		return err
+	}
+	_, err = sm.DB.Exec(`DELETE FROM sessions WHERE user_id = ? AND id != ?`, userID, exceptID)
+	return err
+}
+
+// IssueRefreshToken starts a new refresh token family bound to a session
+func (sm *SessionModel) IssueRefreshToken(session Session) (RefreshToken, error) {
+	family, err := uuid.NewRandom()
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("can't generate refresh token family")
+	}
+	return sm.insertRefreshToken(sm.DB, session, family.String())
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func (sm *SessionModel) insertRefreshToken(db execer, session Session, family string) (RefreshToken, error) {
+	token, err := generateToken()
+	if err != nil {
+		return RefreshToken{}, err
+	}
+
+	refresh := RefreshToken{
+		Token:     token,
+		UserID:    session.UserID,
+		Family:    family,
+		SessionID: session.ID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	query := `
+		INSERT INTO refresh_tokens (user_id, family, token_hash, session_id, expires_at)
+		VALUES (?, ?, ?, ?, ?)
+	`
+	_, err = db.Exec(query, refresh.UserID, refresh.Family, hashToken(refresh.Token), refresh.SessionID, refresh.ExpiresAt)
+	if err != nil {
+		return RefreshToken{}, fmt.Errorf("failed to insert refresh token: %v", err)
+	}
+	return refresh, nil
+}
+
+// RotateRefreshToken trades a refresh token for a brand new session and a
+// successor token in the same family. Presenting a token that was already
+// rotated revokes the whole family and every session it produced, unless it
+// was rotated less than RefreshReuseGrace ago: that is ErrRefreshTokenRotated
+// and the caller should retry with the cookies the other request received.
+// With ErrRefreshTokenReused, the session and token returned only carry the
+// user and the family that was revoked.
+func (sm *SessionModel) RotateRefreshToken(token, userAgent, ip string) (Session, RefreshToken, error) {
+	tx, err := sm.DB.Begin()
+	if err != nil {
+		return Session{}, RefreshToken{}, err
+	}
+	defer tx.Rollback()
+
+	var (
+		id, userID int
+		family     string
+		sessionID  sql.NullInt64
+		expiresAt  time.Time
+		usedAt     sql.NullTime
+	)
+	query := `SELECT id, user_id, family, session_id, expires_at, used_at FROM refresh_tokens WHERE token_hash = ?`
+	err = tx.QueryRow(query, hashToken(token)).Scan(&id, &userID, &family, &sessionID, &expiresAt, &usedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Session{}, RefreshToken{}, ErrInvalidRefreshToken
+		}
+		return Session{}, RefreshToken{}, err
+	}
+
+	if usedAt.Valid && time.Since(usedAt.Time) < RefreshReuseGrace {
+		return Session{}, RefreshToken{}, ErrRefreshTokenRotated
+	}
+	if usedAt.Valid {
+		if err := revokeRefreshFamily(tx, family); err != nil {
+			return Session{}, RefreshToken{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return Session{}, RefreshToken{}, err
+		}
+		return Session{UserID: userID}, RefreshToken{UserID: userID, Family: family}, ErrRefreshTokenReused
+	}
+	if time.Now().After(expiresAt) {
+		return Session{}, RefreshToken{}, ErrInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at = ? WHERE id = ?`, time.Now(), id); err != nil {
+		return Session{}, RefreshToken{}, err
+	}
+	if sessionID.Valid {
+		if _, err := tx.Exec(`DELETE FROM sessions WHERE id = ?`, sessionID.Int64); err != nil {
+			return Session{}, RefreshToken{}, err
+		}
+	}
+
+	session, err := sm.GenerateNewSession(userID, userAgent, ip)
+	if err != nil {
+		return Session{}, RefreshToken{}, err
+	}
+	res, err := tx.Exec(`
+		INSERT INTO sessions (user_id, token, user_agent, ip, created_at, last_seen_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		session.UserID, session.Token, session.UserAgent, session.IP, session.CreatedAt, session.LastSeenAt, session.ExpiresAt)
+	if err != nil {
+		return Session{}, RefreshToken{}, fmt.Errorf("failed to insert session: %v", err)
+	}
+	newID, err := res.LastInsertId()
+	if err != nil {
+		return Session{}, RefreshToken{}, err
+	}
+	session.ID = int(newID)
+
+	refresh, err := sm.insertRefreshToken(tx, session, family)
+	if err != nil {
+		return Session{}, RefreshToken{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Session{}, RefreshToken{}, err
+	}
+	return session, refresh, nil
+}
+
+// revokeRefreshFamily deletes every token of a family and the sessions they created
+func revokeRefreshFamily(db execer, family string) error {
+	_, err := db.Exec(`
+		DELETE FROM sessions
+		WHERE id IN (SELECT session_id FROM refresh_tokens WHERE family = ? AND session_id IS NOT NULL)`, family)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`DELETE FROM refresh_tokens WHERE family = ?`, family)
+	return err
+}
+
+// RefreshCookie builds the refresh_token cookie, scoped to the refresh endpoint only
+func RefreshCookie(refresh RefreshToken) http.Cookie {
+	return http.Cookie{
+		Name:     "refresh_token",
+		Value:    refresh.Token,
+		Path:     "/refresh",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+		Expires:  refresh.ExpiresAt,
+	}
+}
+
+// CreateMFAChallenge issues the short-lived token that stands between a valid
+// password and a real session on 2FA accounts
+func (sm *SessionModel) CreateMFAChallenge(userID int, remember bool) (string, error) {
+	token, err := generateToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	if _, err := sm.DB.Exec(`DELETE FROM mfa_challenges WHERE expires_at < ?`, now); err != nil {
+		return "", err
+	}
+
+	query := `INSERT INTO mfa_challenges (user_id, token_hash, remember_me, expires_at) VALUES (?, ?, ?, ?)`
+	if _, err := sm.DB.Exec(query, userID, hashToken(token), remember, now.Add(MFAChallengeTTL)); err != nil {
+		return "", fmt.Errorf("failed to insert challenge: %v", err)
+	}
+	return token, nil
+}
+
+// GetMFAChallenge looks up a pending, unexpired challenge
+func (sm *SessionModel) GetMFAChallenge(token string) (MFAChallenge, error) {
+	var challenge MFAChallenge
+	query := `
+		SELECT id, user_id, remember_me FROM mfa_challenges
+		WHERE token_hash = ? AND expires_at > ? AND attempts < ?`
+	err := sm.DB.QueryRow(query, hashToken(token), time.Now(), mfaChallengeAttempts).
+		Scan(&challenge.ID, &challenge.UserID, &challenge.RememberMe)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return MFAChallenge{}, ErrInvalidMFAChallenge
+		}
+		return MFAChallenge{}, err
+	}
+	return challenge, nil
+}
+
+// FailMFAChallenge counts a wrong code against the challenge
+func (sm *SessionModel) FailMFAChallenge(challengeID int) error {
+	_, err := sm.DB.Exec(`UPDATE mfa_challenges SET attempts = attempts + 1 WHERE id = ?`, challengeID)
+	return err
 }
 
-func (sm *SessionModel) DeleteSession(UserID int) error {
-	_, err := sm.DB.Exec(`DELETE FROM sessions WHERE user_id = ?`, UserID)
+// DeleteMFAChallenge consumes a challenge once the sign in is complete
+func (sm *SessionModel) DeleteMFAChallenge(challengeID int) error {
+	_, err := sm.DB.Exec(`DELETE FROM mfa_challenges WHERE id = ?`, challengeID)
 	return err
 }
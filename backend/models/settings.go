@@ -0,0 +1,195 @@
+package models
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	_ "time/tzdata" // timezones validate the same without the system database
+)
+
+// SettingsVersion is the layout of Settings written today. Stored settings
+// of older versions are upgraded by migrateSettings when they're read.
+const SettingsVersion = 1
+
+// Who may start or continue a private conversation with a user
+const (
+	DMEveryone  = "everyone"
+	DMFollowing = "following" // people the user follows
+	DMNobody    = "nobody"
+)
+
+var (
+	ErrDMsClosed        = errors.New("this user doesn't accept private messages")
+	ErrDMsFollowingOnly = errors.New("this user only accepts messages from people they follow")
+)
+
+// Settings are a user's preferences and privacy choices, stored as one JSON
+// document per user
+type Settings struct {
+	Version       int                  `json:"version"`
+	DMPolicy      string               `json:"dm_policy"`
+	ShowOnline    bool                 `json:"show_online"` // presence events, online state and last seen
+	Notifications NotificationSettings `json:"notifications"`
+	Timezone      string               `json:"timezone"` // IANA name, e.g. "Europe/Paris"
+	Theme         string               `json:"theme"`
+}
+
+type NotificationSettings struct {
+	Messages bool `json:"messages"` // new private messages
+	Mentions bool `json:"mentions"`
+	Follows  bool `json:"follows"` // new followers
+	Email    bool `json:"email"`   // also send them by email
+}
+
+// DefaultSettings are the settings of users who never changed any
+func DefaultSettings() *Settings {
+	return &Settings{
+		Version:    SettingsVersion,
+		DMPolicy:   DMEveryone,
+		ShowOnline: true,
+		Notifications: NotificationSettings{
+			Messages: true,
+			Mentions: true,
+			Follows:  true,
+		},
+		Timezone: "UTC",
+		Theme:    "system",
+	}
+}
+
+// ValidateSettings checks every field of a settings document
+func ValidateSettings(settings *Settings) error {
+	var dmPolicy, timezone, theme error
+	switch settings.DMPolicy {
+	case DMEveryone, DMFollowing, DMNobody:
+	default:
+		dmPolicy = errors.New("dm_policy must be 'everyone', 'following' or 'nobody'")
+	}
+	if _, err := time.LoadLocation(settings.Timezone); err != nil || settings.Timezone == "" || settings.Timezone == "Local" {
+		timezone = fmt.Errorf("unknown timezone %q", settings.Timezone)
+	}
+	switch settings.Theme {
+	case "system", "light", "dark":
+	default:
+		theme = errors.New("theme must be 'system', 'light' or 'dark'")
+	}
+
+	return fieldErrors(map[string]error{
+		"dm_policy": dmPolicy,
+		"timezone":  timezone,
+		"theme":     theme,
+	})
+}
+
+// migrateSettings upgrades a stored document to SettingsVersion. Settings
+// missing from older versions keep their defaults.
+func migrateSettings(version int, data []byte) (*Settings, error) {
+	if version > SettingsVersion {
+		return nil, fmt.Errorf("settings version %d is newer than %d", version, SettingsVersion)
+	}
+	settings := DefaultSettings()
+	if err := json.Unmarshal(data, settings); err != nil {
+		return nil, fmt.Errorf("invalid stored settings: %w", err)
+	}
+	// version 1 is the first layout, later ones convert renamed fields here
+	settings.Version = SettingsVersion
+	return settings, nil
+}
+
+type SettingsModel struct {
+	DB *sql.DB
+}
+
+// GetSettings returns the user's settings, the defaults if they have none
+func (sm *SettingsModel) GetSettings(userID int) (*Settings, error) {
+	var version int
+	var data []byte
+	err := sm.DB.QueryRow(`SELECT version, data FROM user_settings WHERE user_id = ?`, userID).Scan(&version, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultSettings(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return migrateSettings(version, data)
+}
+
+// UpdateSettings applies a partial JSON document on top of the user's
+// settings: fields it leaves out keep their value. Unknown fields and
+// invalid values are a *ValidationError.
+func (sm *SettingsModel) UpdateSettings(userID int, patch []byte) (*Settings, error) {
+	settings, err := sm.GetSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(settings); err != nil {
+		return nil, &ValidationError{Fields: map[string]string{"settings": err.Error()}}
+	}
+	settings.Version = SettingsVersion
+	if err := ValidateSettings(settings); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	_, err = sm.DB.Exec(`
+		INSERT INTO user_settings (user_id, version, data) VALUES (?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET version = excluded.version, data = excluded.data, updated_at = CURRENT_TIMESTAMP
+	`, userID, settings.Version, string(data))
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// CheckDM tells whether senderID may message receiverID under the
+// receiver's dm_policy, returning ErrDMsClosed or ErrDMsFollowingOnly if not
+func (sm *SettingsModel) CheckDM(senderID, receiverID int) error {
+	settings, err := sm.GetSettings(receiverID)
+	if err != nil {
+		return err
+	}
+
+	switch settings.DMPolicy {
+	case DMNobody:
+		return ErrDMsClosed
+	case DMFollowing:
+		var follows bool
+		err := sm.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM follows WHERE follower_id = ? AND followee_id = ?)`,
+			receiverID, senderID).Scan(&follows)
+		if err != nil {
+			return err
+		}
+		if !follows {
+			return ErrDMsFollowingOnly
+		}
+	}
+	return nil
+}
+
+// HiddenPresence returns the users who don't show when they're online
+func (sm *SettingsModel) HiddenPresence() (map[int]bool, error) {
+	rows, err := sm.DB.Query(`SELECT user_id FROM user_settings WHERE json_extract(data, '$.show_online') = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	hidden := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		hidden[id] = true
+	}
+	return hidden, rows.Err()
+}
@@ -0,0 +1,263 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults every authenticator app understands
+const (
+	totpIssuer = "echohub"
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1 // accepted steps before/after the current one
+
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnrolled    = errors.New("two-factor authentication enrollment not started")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrInvalidTOTPCode    = errors.New("invalid authentication code")
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// TwoFactor carries 2FA requests and responses
+type TwoFactor struct {
+	Challenge     string   `json:"challenge,omitempty"`
+	Code          string   `json:"code,omitempty"`
+	Secret        string   `json:"secret,omitempty"`
+	URI           string   `json:"otpauth_uri,omitempty"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+	Required      bool     `json:"two_factor_required,omitempty"`
+}
+
+// BeginTOTPEnrollment generates a new pending TOTP secret for the user and
+// returns it along with the otpauth:// URI to render as a QR code.
+// 2FA stays off until the secret is confirmed with a valid code.
+func (um *UserModel) BeginTOTPEnrollment(userID int) (string, string, error) {
+	var username string
+	var enabledAt sql.NullTime
+	err := um.DB.QueryRow(`SELECT username, totp_enabled_at FROM users WHERE id = ?`, userID).Scan(&username, &enabledAt)
+	if err != nil {
+		return "", "", err
+	}
+	if enabledAt.Valid {
+		return "", "", ErrTOTPAlreadyEnabled
+	}
+
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", fmt.Errorf("can't generate totp secret: %w", err)
+	}
+	secret := totpEncoding.EncodeToString(raw)
+
+	if _, err := um.DB.Exec(`UPDATE users SET totp_secret = ?, totp_last_step = 0 WHERE id = ?`, secret, userID); err != nil {
+		return "", "", err
+	}
+
+	return secret, totpURI(username, secret), nil
+}
+
+// ConfirmTOTP turns 2FA on once the user proves their app produces valid
+// codes, and hands out a fresh set of recovery codes
+func (um *UserModel) ConfirmTOTP(userID int, code string) ([]string, error) {
+	secret, enabled, lastStep, err := um.getTOTP(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+	if secret == "" {
+		return nil, ErrTOTPNotEnrolled
+	}
+
+	step, ok := verifyTOTP(secret, code, lastStep)
+	if !ok {
+		return nil, ErrInvalidTOTPCode
+	}
+
+	_, err = um.DB.Exec(`UPDATE users SET totp_enabled_at = ?, totp_last_step = ? WHERE id = ?`, time.Now(), step, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return um.ReplaceRecoveryCodes(userID)
+}
+
+// DisableTOTP turns 2FA off after checking a current code or a recovery code
+func (um *UserModel) DisableTOTP(userID int, code string) error {
+	if err := um.VerifySecondFactor(userID, code); err != nil {
+		return err
+	}
+
+	_, err := um.DB.Exec(`UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = 0 WHERE id = ?`, userID)
+	if err != nil {
+		return err
+	}
+	_, err = um.DB.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID)
+	return err
+}
+
+// HasTOTP reports whether the user has 2FA turned on
+func (um *UserModel) HasTOTP(userID int) (bool, error) {
+	_, enabled, _, err := um.getTOTP(userID)
+	return enabled, err
+}
+
+// VerifySecondFactor accepts either a TOTP code (each one usable once) or
+// one of the user's unused recovery codes
+func (um *UserModel) VerifySecondFactor(userID int, code string) error {
+	secret, enabled, lastStep, err := um.getTOTP(userID)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return ErrTOTPNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if step, ok := verifyTOTP(secret, code, lastStep); ok {
+		// remember the step so the same code can't be replayed; the condition
+		// makes concurrent requests with one code accept it only once
+		res, err := um.DB.Exec(`UPDATE users SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return ErrInvalidTOTPCode
+		}
+		return nil
+	}
+
+	res, err := um.DB.Exec(`
+		UPDATE recovery_codes SET used_at = ?
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		time.Now(), userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidTOTPCode
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes drops the user's recovery codes and issues new ones.
+// The plain codes are only ever returned here.
+func (um *UserModel) ReplaceRecoveryCodes(userID int) ([]string, error) {
+	tx, err := um.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, fmt.Errorf("can't generate recovery code: %w", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(raw)) // 8 characters
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES (?, ?)`, userID, hashToken(code)); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:4]+"-"+code[4:])
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (um *UserModel) getTOTP(userID int) (secret string, enabled bool, lastStep int64, err error) {
+	var nullSecret sql.NullString
+	var enabledAt sql.NullTime
+	err = um.DB.QueryRow(`SELECT totp_secret, totp_enabled_at, totp_last_step FROM users WHERE id = ?`, userID).
+		Scan(&nullSecret, &enabledAt, &lastStep)
+	if err != nil {
+		return "", false, 0, err
+	}
+	return nullSecret.String, enabledAt.Valid && nullSecret.Valid, lastStep, nil
+}
+
+func totpURI(account, secret string) string {
+	params := url.Values{}
+	params.Set("secret", secret)
+	params.Set("issuer", totpIssuer)
+	params.Set("algorithm", "SHA1")
+	params.Set("digits", fmt.Sprint(totpDigits))
+	params.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(totpIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + params.Encode()
+}
+
+// verifyTOTP checks a code against the steps around now, refusing steps at or
+// before lastStep. It returns the matching step.
+func verifyTOTP(secret, code string, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := time.Now().Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value (RFC 4226) for a time step
+func totpCode(key []byte, step int64) string {
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range totpDigits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+}
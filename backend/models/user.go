@@ -5,9 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
-
-	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
@@ -20,38 +19,51 @@ type User struct {
 	Gender         string         `json:"gender"`
 	Password       string         `json:"password"` // plain text (only for input)
 	RepeatedPass   string         `json:"repeated_password"`
+	RememberMe     bool           `json:"remember_me"` // only for sign in
 	HashedPassword []byte         // stored hashed password
 	Token          string         `json:"token"`
 	ProfileImg     string         `json:"profile_img"`
+	Role           string         `json:"role"`
+	EmailVerified  bool           `json:"email_verified"`
 	ConversationID sql.NullInt64  `json:"conversation_id"`
 	CreatedAt      time.Time      `json:"created_at"`      // ISO8601 datetime string
 	LastMessageAt  sql.NullString `json:"last_message_at"` // ISO8601 datetime string or empty
+	LastSeenAt     *time.Time     `json:"last_seen_at"`    // nil until their first chat connection
+	IsOnline       bool           `json:"is_online"`       // filled in from the chat hub
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB      *sql.DB
+	Hasher  *PasswordHasher // defaults to DefaultPasswordHasher
+	Policy  *Policy         // defaults to DefaultPolicy
+	Avatars AvatarProvider  // defaults to IdenticonProvider
+
+	dummyOnce sync.Once
+	dummyHash []byte
 }
 
-// InsertUser inserts a new user, setting created_at via SQLite default
-func (um *UserModel) InsertUser(user User) error {
-	hashedPwd, err := bcrypt.GenerateFromPassword([]byte(user.Password), 12)
+// InsertUser inserts a new (unverified) user, setting created_at via SQLite default,
+// and returns its ID. An email or username taken since ValidateUser ran is a
+// *ValidationError.
+func (um *UserModel) InsertUser(user User) (int, error) {
+	hashedPwd, err := um.hashPassword(user.Password)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	user.HashedPassword = hashedPwd
 
 	// Assign avatar before insertion
-	user.ProfileImg, err = AssignAvatar(user.UserName, user.Gender)
+	user.ProfileImg, err = um.assignAvatar(user.UserName, user.Gender)
 	if err != nil {
-		return err
+		return 0, err
 	}
 
 	query := `
-		INSERT OR IGNORE INTO users 
+		INSERT INTO users
 			(username, first_name, last_name, email, birth_date, gender, hashed_password, profile_img)
 		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err = um.DB.Exec(query,
+	res, err := um.DB.Exec(query,
 		user.UserName,
 		user.FirstName,
 		user.LastName,
@@ -62,15 +74,35 @@ func (um *UserModel) InsertUser(user User) error {
 		user.ProfileImg,
 	)
 	if err != nil {
-		return err
+		switch {
+		case isUniqueViolation(err, "users.email"):
+			return 0, fieldError("email", errors.New("this email '"+user.Email+"' is already registered"))
+		case isUniqueViolation(err, "users.username"):
+			return 0, fieldError("username", errors.New("'"+user.UserName+"' is already taken"))
+		}
+		return 0, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if affected == 0 {
+		return 0, errors.New("user was not inserted")
 	}
 
-	return nil
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(userID), nil
 }
 
 func (um *UserModel) GetUserByID(userID int) (*User, error) {
 	user := &User{}
-	query := `SELECT id, username, first_name, last_name, email, birth_date, gender, profile_img, created_at FROM users WHERE id = ?`
+	query := `
+		SELECT id, username, first_name, last_name, email, birth_date, gender, profile_img, role,
+		       email_verified_at IS NOT NULL, created_at
+		FROM users WHERE id = ?`
 	err := um.DB.QueryRow(query, userID).Scan(
 		&user.ID,
 		&user.UserName,
@@ -80,6 +112,8 @@ func (um *UserModel) GetUserByID(userID int) (*User, error) {
 		&user.Birthday,
 		&user.Gender,
 		&user.ProfileImg,
+		&user.Role,
+		&user.EmailVerified,
 		&user.CreatedAt,
 	)
 	if err != nil {
@@ -88,34 +122,183 @@ func (um *UserModel) GetUserByID(userID int) (*User, error) {
 	return user, nil
 }
 
+// GetUserByEmail looks a user up by email, used by the password recovery flow
+func (um *UserModel) GetUserByEmail(email string) (*User, error) {
+	var userID int
+	email = strings.ToLower(strings.TrimSpace(email))
+	err := um.DB.QueryRow(`SELECT id FROM users WHERE email = ?`, email).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	return um.GetUserByID(userID)
+}
+
+// MarkEmailVerified flags the user's email as verified, provided it is still
+// the address the verification link was sent to
+func (um *UserModel) MarkEmailVerified(userID int, email string) error {
+	res, err := um.DB.Exec(`
+		UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?)
+		WHERE id = ? AND email = ?`, time.Now(), userID, email)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrInvalidVerification
+	}
+	return nil
+}
+
+// UpdateRole changes the role of a user
+func (um *UserModel) UpdateRole(userID int, role string) error {
+	if err := ValidateRole(role); err != nil {
+		return err
+	}
+
+	res, err := um.DB.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdatePassword hashes and stores a new password for the user
+func (um *UserModel) UpdatePassword(userID int, password string) error {
+	hashedPwd, err := um.hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	res, err := um.DB.Exec(`UPDATE users SET hashed_password = ? WHERE id = ?`, hashedPwd, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return errors.New("no user found with the given ID")
+	}
+	return nil
+}
+
+func (um *UserModel) hasher() *PasswordHasher {
+	if um.Hasher == nil {
+		um.Hasher = DefaultPasswordHasher()
+	}
+	return um.Hasher
+}
+
+// ActivePolicy returns the password and username rules in use
+func (um *UserModel) ActivePolicy() *Policy {
+	if um.Policy == nil {
+		um.Policy = DefaultPolicy()
+	}
+	return um.Policy
+}
+
+func (um *UserModel) avatars() AvatarProvider {
+	if um.Avatars == nil {
+		um.Avatars = IdenticonProvider{}
+	}
+	return um.Avatars
+}
+
+// assignAvatar draws the first avatar of a new account and stores it
+func (um *UserModel) assignAvatar(username, gender string) (string, error) {
+	data, err := um.avatars().Avatar(username, gender)
+	if err != nil {
+		return "", err
+	}
+	return SaveAvatar(data)
+}
+
+func (um *UserModel) hashPassword(password string) ([]byte, error) {
+	return um.hasher().Hash(password)
+}
+
+// dummyPasswordHash is compared against when no account matches a sign in
+func (um *UserModel) dummyPasswordHash() []byte {
+	um.dummyOnce.Do(func() {
+		um.dummyHash, _ = um.hashPassword("not-a-real-password")
+	})
+	return um.dummyHash
+}
+
+// checkPassword verifies password against the stored hash and, when the hash
+// is outdated (other algorithm or settings), replaces it with a fresh one.
+func (um *UserModel) checkPassword(userID int, hash []byte, password string) error {
+	ok, rehash, err := um.hasher().Verify(hash, password)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrWrongPassword
+	}
+
+	if rehash {
+		if newHash, err := um.hashPassword(password); err == nil {
+			// best effort: the old hash keeps working if this fails
+			um.DB.Exec(`UPDATE users SET hashed_password = ? WHERE id = ? AND CAST(hashed_password AS BLOB) = CAST(? AS BLOB)`, newHash, userID, hash)
+		}
+	}
+	return nil
+}
+
 func (um *UserModel) ValidateUser(user *User, state string) error {
 	user.UserName = strings.ToLower(strings.TrimSpace(user.UserName))
 	user.Email = strings.ToLower(strings.TrimSpace(user.Email))
 
 	switch state {
 	case "newUser":
-		if err := firstNameCheck(user.FirstName); err != nil {
+		return fieldErrors(map[string]error{
+			"first_name": um.firstNameCheck(user.FirstName),
+			"last_name":  um.lastNameCheck(user.LastName),
+			"username":   um.usernameCheck(user.UserName),
+			"email":      um.emailCheck(user.Email),
+			"birth_date": ageCheck(user.Birthday),
+			"gender":     genderCheck(user.Gender),
+			"password":   um.passwordCheck(user.Password, user.RepeatedPass),
+		})
+
+	case "profile":
+		// partial update of user.ID: empty or unchanged fields are left alone
+		current, err := um.GetUserByID(user.ID)
+		if err != nil {
 			return err
 		}
-		if err := um.lastNameCheck(user.LastName); err != nil {
-			return err
+		if user.UserName == current.UserName {
+			user.UserName = ""
 		}
-		if err := um.usernameCheck(user.UserName); err != nil {
-			return err
+		if user.Email == current.Email {
+			user.Email = ""
 		}
-		if err := um.emailCheck(user.Email); err != nil {
-			return err
+
+		checks := map[string]error{}
+		if user.FirstName != "" {
+			checks["first_name"] = um.firstNameCheck(user.FirstName)
 		}
-		if err := ageCheck(user.Birthday); err != nil {
-			return err
+		if user.LastName != "" {
+			checks["last_name"] = um.lastNameCheck(user.LastName)
 		}
-		if err := genderCheck(user.Gender); err != nil {
-			return err
+		if user.UserName != "" {
+			checks["username"] = um.usernameCheck(user.UserName)
 		}
-		if err := passwordCheck(user.Password, user.RepeatedPass); err != nil {
-			return err
+		if user.Email != "" {
+			checks["email"] = um.emailCheck(user.Email)
 		}
-		return nil
+		return fieldErrors(checks)
 
 	case "User":
 		if user.UserName == "" && user.Email == "" {
@@ -135,6 +318,8 @@ func (um *UserModel) ValidateUser(user *User, state string) error {
 		err := um.DB.QueryRow(query, identifier).Scan(&user.ID, &user.HashedPassword)
 		if err != nil {
 			if err == sql.ErrNoRows {
+				// spend as long as a real check would, so response times don't reveal unknown accounts
+				um.hasher().Verify(um.dummyPasswordHash(), user.Password)
 				return fmt.Errorf("user not found")
 			}
 			return fmt.Errorf("database error: %v", err)
@@ -145,7 +330,7 @@ func (um *UserModel) ValidateUser(user *User, state string) error {
 			return fmt.Errorf("password is required")
 		}
 
-		if err := bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(user.Password)); err != nil {
+		if err := um.checkPassword(user.ID, user.HashedPassword, user.Password); err != nil {
 			return fmt.Errorf("invalid password")
 		}
 		return nil
@@ -167,6 +352,7 @@ func (um *UserModel) GetSortedUsersByConversation(userID int) ([]User, error) {
 			users.gender,
 			users.profile_img,
 			users.created_at,
+			users.last_seen_at,
 			conversations.id as convid,
 			CASE
 				WHEN conversations.user2_id = ? THEN conversations.last_message_at
@@ -204,6 +390,7 @@ func (um *UserModel) GetSortedUsersByConversation(userID int) ([]User, error) {
 			&user.Gender,
 			&user.ProfileImg,
 			&user.CreatedAt,
+			&user.LastSeenAt,
 			&user.ConversationID,
 			&user.LastMessageAt,
 		)
@@ -216,22 +403,17 @@ func (um *UserModel) GetSortedUsersByConversation(userID int) ([]User, error) {
 	return users, nil
 }
 
+// UpdateLastSeen records when the user was last connected to the chat
+func (um *UserModel) UpdateLastSeen(userID int, at time.Time) error {
+	_, err := um.DB.Exec(`UPDATE users SET last_seen_at = ? WHERE id = ?`, at, userID)
+	return err
+}
+
 // usernameCheck ensures username validity and uniqueness
 func (um *UserModel) usernameCheck(username string) error {
 	username = strings.ToLower(strings.TrimSpace(username))
-	if username == "" {
-		return errors.New("username is required")
-	}
-	if len(username) < 3 || len(username) > 20 {
-		return errors.New("username must be between 3 and 20 characters")
-	}
-	if username[0] == '_' || username[len(username)-1] == '_' {
-		return errors.New("username cannot start or end with '_'")
-	}
-	for _, c := range username {
-		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') && c != '_' {
-			return errors.New("username can only contain letters, numbers and underscores")
-		}
+	if err := um.ActivePolicy().CheckUsername(username); err != nil {
+		return err
 	}
 	var existing string
 	err := um.DB.QueryRow("SELECT username FROM users WHERE username = ?", username).Scan(&existing)
@@ -239,7 +421,7 @@ func (um *UserModel) usernameCheck(username string) error {
 		return errors.New("'" + username + "' is already taken")
 	}
 	if err != sql.ErrNoRows {
-		return err
+		return fmt.Errorf("%w: %v", errDatabase, err)
 	}
 	return nil
 }
@@ -277,7 +459,7 @@ func (um *UserModel) emailCheck(email string) error {
 		return errors.New("this email '" + email + "' is already registered")
 	}
 	if err != sql.ErrNoRows {
-		return err
+		return fmt.Errorf("%w: %v", errDatabase, err)
 	}
 	return nil
 }
@@ -294,69 +476,26 @@ func genderCheck(gender string) error {
 	return nil
 }
 
-func passwordCheck(password, repeatedPassword string) error {
-	if password == "" {
-		return errors.New("password is required")
-	}
-	if password != repeatedPassword {
+// ValidatePassword applies the signup password rules to a new password
+func (um *UserModel) ValidatePassword(password, repeatedPassword string) error {
+	return fieldError("password", um.passwordCheck(password, repeatedPassword))
+}
+
+// passwordCheck applies the password policy plus what the configured hasher can take
+func (um *UserModel) passwordCheck(password, repeatedPassword string) error {
+	if password != "" && password != repeatedPassword {
 		return errors.New("password and repeated password must match")
 	}
-	if len(password) < 8 || len(password) > 64 {
-		return errors.New("password length must be between 8 and 64 characters")
-	}
-	var hasUpper, hasLower, hasDigit, hasSpecial bool
-	specialChars := "!@#$%^&*()-_=+[]{}|;:',.<>?/"
-	for _, c := range password {
-		switch {
-		case c >= 'A' && c <= 'Z':
-			hasUpper = true
-		case c >= 'a' && c <= 'z':
-			hasLower = true
-		case c >= '0' && c <= '9':
-			hasDigit = true
-		case strings.ContainsRune(specialChars, c):
-			hasSpecial = true
-		case c == ' ':
-			return errors.New("password cannot contain spaces")
-		}
-	}
-	if !hasUpper {
-		return errors.New("password must contain at least one uppercase letter")
-	}
-	if !hasLower {
-		return errors.New("password must contain at least one lowercase letter")
-	}
-	if !hasDigit {
-		return errors.New("password must contain at least one digit")
-	}
-	if !hasSpecial {
-		return errors.New("password must contain at least one special character")
+	if err := um.ActivePolicy().CheckPassword(password); err != nil {
+		return err
 	}
-	return nil
+	return um.hasher().Accepts(password)
 }
 
-func firstNameCheck(firstName string) error {
-	firstName = strings.TrimSpace(firstName)
-	if len(firstName) < 2 || len(firstName) > 50 {
-		return errors.New("first name must be between 2 and 50 characters")
-	}
-	for _, c := range firstName {
-		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && c != ' ' && c != '-' {
-			return errors.New("first name can only contain letters, spaces, and hyphens")
-		}
-	}
-	return nil
+func (um *UserModel) firstNameCheck(firstName string) error {
+	return um.ActivePolicy().CheckName("first name", firstName)
 }
 
 func (um *UserModel) lastNameCheck(lastName string) error {
-	lastName = strings.TrimSpace(lastName)
-	if len(lastName) < 2 || len(lastName) > 50 {
-		return errors.New("last name must be between 2 and 50 characters")
-	}
-	for _, c := range lastName {
-		if !(c >= 'a' && c <= 'z') && !(c >= 'A' && c <= 'Z') && c != ' ' && c != '-' {
-			return errors.New("last name can only contain letters, spaces, and hyphens")
-		}
-	}
-	return nil
+	return um.ActivePolicy().CheckName("last name", lastName)
 }
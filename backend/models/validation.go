@@ -0,0 +1,74 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ValidationError lists every invalid field of an input, keyed by the field's
+// JSON name, so clients can show each message next to its field
+type ValidationError struct {
+	Fields map[string]string
+}
+
+func (e *ValidationError) Error() string {
+	fields := slices.Sorted(maps.Keys(e.Fields))
+	messages := make([]string, len(fields))
+	for i, field := range fields {
+		messages[i] = field + ": " + e.Fields[field]
+	}
+	return strings.Join(messages, "; ")
+}
+
+// errDatabase marks failed checks that have nothing to do with the input
+var errDatabase = errors.New("database error")
+
+// fieldErrors gathers the results of per-field checks into a *ValidationError,
+// or nil when they all passed. A database failure is returned as is.
+func fieldErrors(checks map[string]error) error {
+	invalid := map[string]string{}
+	for field, err := range checks {
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, errDatabase) {
+			return err
+		}
+		invalid[field] = err.Error()
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	return &ValidationError{Fields: invalid}
+}
+
+// fieldError is a *ValidationError about a single field
+func fieldError(field string, err error) error {
+	return fieldErrors(map[string]error{field: err})
+}
+
+// isUniqueViolation tells whether err is SQLite refusing a duplicate in the
+// UNIQUE column (written "table.column"), e.g. when a concurrent request
+// took a value after it was validated
+func isUniqueViolation(err error, column string) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) &&
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique &&
+		strings.Contains(sqliteErr.Error(), column)
+}
+
+// textCheck requires a (trimmed) text input of at most max characters
+func textCheck(name, value string, max int) error {
+	if value == "" {
+		return fmt.Errorf("%s cannot be empty or whitespace", name)
+	}
+	if len(value) > max {
+		return fmt.Errorf("%s must be at most %d characters long", name, max)
+	}
+	return nil
+}
@@ -1,4 +1,4 @@
-import { timeAgo } from "../tools.js";
+import { apiRequest, timeAgo } from "../tools.js";
 
 // Global variables for notification badge and chat management
 let unreadCount = 0;
@@ -78,11 +78,9 @@ export const Chat = {
 
 const getCurrentUser = async () => {
   try {
-    const res = await fetch("/me", {
-      method: "POST",
-      headers: { "Content-Type": "application/json" }
-    });
-    if (res.ok) return await res.json();
+    // through apiRequest so an expired session is refreshed before the socket opens
+    const { status, data } = await apiRequest("/me", undefined, "POST");
+    if (status === 200) return data;
     return null;
   } catch (err) {
     console.error("Error getting current user:", err);
@@ -128,8 +126,11 @@ const initWebSocket = () => {
         case 'ack':
           handleAckMessage(msg);
           break;
-        case 'user_status':
-          handleUserStatusChange(msg);
+        case 'error':
+          handleRefusedMessage(msg);
+          break;
+        case 'presence':
+          handlePresence(msg);
           break;
         default:
           if (msg.content && msg.author_id) {
@@ -370,12 +371,13 @@ const handleIncomingMessage = (msg) => {
   }
 };
 
-// Handle user status changes (online/offline)
-const handleUserStatusChange = (user) => {
-
-
-  updateUserInChatList(user.ID, { is_online: user.isOnline });
-  console.log(`👤 User ${user.ID} is now ${user.isOnline ? 'online' : 'offline'}`);
+// Handle presence events (a user came online or went offline)
+const handlePresence = (presence) => {
+  updateUserInChatList(presence.user_id, {
+    is_online: presence.online,
+    last_seen_at: presence.last_seen_at,
+  });
+  console.log(`👤 User ${presence.user_id} is now ${presence.online ? 'online' : 'offline'}`);
 };
 
 // Handle typing indicators
@@ -406,6 +408,19 @@ const handleAckMessage = (msg) => {
   });
 };
 
+// Handle messages the server refused to deliver (e.g. blocked users)
+const handleRefusedMessage = (msg) => {
+  document.querySelectorAll(".bubble.outgoing.pending").forEach(bubble => {
+    if (bubble.dataset.tempid === String(msg.temp_id)) {
+      bubble.classList.remove("pending");
+      bubble.classList.add("error");
+      bubble.title = msg.content;
+      const timestamp = bubble.querySelector(".message-time");
+      if (timestamp) timestamp.textContent = msg.content;
+    }
+  });
+};
+
 // Helper functions
 const compareConversationIds = (id1, id2) => {
   const getId = (id) => {
@@ -422,6 +437,11 @@ const truncateMessage = (message, maxLength = 30) => {
   return message.substring(0, maxLength) + '...';
 };
 
+const presenceLabel = (user) => {
+  if (user.is_online) return 'Online';
+  return user.last_seen_at ? `Last seen ${timeAgo(user.last_seen_at)}` : 'Offline';
+};
+
 const updateOnlineCount = (count) => {
   const onlineCountEl = document.getElementById("online-count");
   if (onlineCountEl) {
@@ -459,7 +479,7 @@ const openChat = async (user) => {
         <div>
           <strong>${user.first_name} ${user.last_name}</strong>
           <small>@${user.username || ''}</small>
-          <div class="user-status">${user.is_online ? 'Online' : 'Offline'}</div>
+          <div class="user-status">${presenceLabel(user)}</div>
         </div>
       </div>
     </div>
@@ -568,7 +588,8 @@ const setupMessageForm = (user) => {
     if (window.ws?.readyState === WebSocket.OPEN) {
       window.ws.send(JSON.stringify({
         type: "typing",
-        conversation_id: window.currentConversationId
+        conversation_id: window.currentConversationId,
+        reciever_id: user.id
       }));
     }
   });
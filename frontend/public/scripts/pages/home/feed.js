@@ -19,6 +19,8 @@ const getPayload = () => {
     return { target: "feed", start_id: lastPostId, n_post: 5 };
   } else if (currentCategoryId === "mine") {
     return { target: "user", start_id: lastPostId, n_post: 5 };
+  } else if (currentCategoryId === "following") {
+    return { target: "following", start_id: lastPostId, n_post: 5 };
   } else {
     return { target: "category", start_id: lastPostId, n_post: 5, category_id: currentCategoryId };
   }
@@ -112,6 +114,10 @@ const createPostElement = (post, postsContainer) => {
   const createdAt = document.createElement("span");
   createdAt.className = "time-ago";
   createdAt.textContent = timeAgo(post.created_at);
+  if (post.edited) {
+    createdAt.textContent += " · edited";
+    createdAt.title = `Edited ${timeAgo(post.edited_at)}`;
+  }
 
   userInfo.appendChild(username);
   userInfo.appendChild(createdAt);
@@ -128,6 +134,10 @@ const createPostElement = (post, postsContainer) => {
   const content = document.createElement("p");
   content.id = "post-content";
   content.textContent = post.content;
+  if (post.deleted) {
+    title.classList.add("removed");
+    content.classList.add("removed");
+  }
 
   // Footer
   const footer = document.createElement("div");
@@ -257,7 +267,7 @@ const openCommentsPopup = (postID) => {
         commentInput.value = "";
         prependComment(commentList, data);
       } else {
-        PopupMessage("Couldn't post comment", "error");
+        PopupMessage(data?.error?.fields?.content || "Couldn't post comment", "error");
         console.error(error);
       }
 
@@ -322,6 +332,7 @@ const openCommentsPopup = (postID) => {
 
       const contentP = document.createElement('p');
       contentP.textContent = comment.content;
+      if (comment.deleted) contentP.classList.add('removed');
 
       const metaDiv = document.createElement('div');
       metaDiv.innerHTML = `<strong>${comment.username}</strong> • ${timeAgo(comment.created_at)}`;
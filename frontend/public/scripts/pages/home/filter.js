@@ -15,6 +15,12 @@ const personalCategories = [
     name: "My Posts",
     description: "Your personal posts",
     icon: "person",
+  },
+  {
+    id: "following",
+    name: "Following",
+    description: "Posts from people you follow",
+    icon: "group",
   }
 ]; 
 
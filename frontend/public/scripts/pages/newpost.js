@@ -112,6 +112,8 @@ const onSubmit = async (e) => {
   if (status === 201 || status === 200) {
     PopupMessage("Post created successfully!", 'success');
     Browse('/');
+  } else if (data?.error?.fields) {
+    showErrors(form, data.error.fields);
   } else {
     handleError({ status, message: error || data });
   }
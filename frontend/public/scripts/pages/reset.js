@@ -0,0 +1,104 @@
+import { apiRequest, PopupMessage } from '../tools.js';
+import { Browse } from '../router.js';
+
+export { ResetPassword }
+
+// Opened from the emailed link (/password/reset?token=...) to choose a new
+// password; without a token it asks for the email to send the link to.
+const ResetPassword = {
+    html: `
+    <head>
+      <link rel="stylesheet" href="/public/styles/account.css">
+    </head>
+    <div id="reset" class="account-card">
+      <h1>Reset Password</h1>
+      <form id="forgotForm" class="hidden">
+        <p>Enter your email and we'll send you a link to choose a new password.</p>
+        <input name="email" type="email" placeholder="Email" />
+        <span class="error" data-for="email"></span>
+
+        <button type="submit">Send Link</button>
+      </form>
+      <form id="resetForm" class="hidden">
+        <input name="password" type="password" placeholder="New Password" />
+        <span class="error" data-for="password"></span>
+
+        <input name="repeated_password" type="password" placeholder="Confirm Password" />
+        <span class="error" data-for="repeated_password"></span>
+
+        <button type="submit">Save Password</button>
+      </form>
+      <p><a href="/signin" data-link>Back to Sign In</a></p>
+    </div>
+    `
+  ,
+
+  setup: () => {
+    const token = new URLSearchParams(window.location.search).get('token');
+    const form = document.getElementById(token ? 'resetForm' : 'forgotForm');
+    form.classList.remove('hidden');
+    form.addEventListener('submit', (e) => token ? onReset(e, token) : onForgot(e));
+  }
+};
+
+// === HELPERS ===
+
+const onForgot = async (e) => {
+  e.preventDefault();
+
+  const form = e.target;
+  clearErrors(form);
+  const email = new FormData(form).get('email')?.trim();
+  if (!/^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(email || '')) {
+    showErrors(form, { email: 'Invalid email' });
+    return;
+  }
+
+  const { status } = await apiRequest('/password/forgot', { email }, 'POST');
+  if (status === 202) {
+    PopupMessage('If this email belongs to an account, a reset link is on its way.', 'success');
+    form.reset();
+  } else {
+    PopupMessage('Unexpected error occurred.');
+  }
+};
+
+const onReset = async (e, token) => {
+  e.preventDefault();
+
+  const form = e.target;
+  clearErrors(form);
+  const data = new FormData(form);
+  const payload = {
+    token,
+    password: data.get('password'),
+    repeated_password: data.get('repeated_password'),
+  };
+  if (payload.password !== payload.repeated_password) {
+    showErrors(form, { repeated_password: 'Passwords do not match' });
+    return;
+  }
+
+  const { status, data: response } = await apiRequest('/password/reset', payload, 'POST');
+  if (status === 200) {
+    PopupMessage('Password changed. Please sign in again.', 'success');
+    Browse('/signin');
+  } else if (response?.error?.fields) {
+    showErrors(form, response.error.fields);
+  } else if (status === 400) {
+    PopupMessage('This reset link is invalid or expired. Ask for a new one.');
+  } else {
+    PopupMessage('Internal server error. Please try again later.');
+  }
+};
+
+const clearErrors = (form) => {
+  form.querySelectorAll('.error').forEach(span => span.textContent = '');
+};
+
+const showErrors = (form, errors) => {
+  for (const key in errors) {
+    const span = form.querySelector(`.error[data-for="${key}"]`);
+    if (span) span.textContent = errors[key];
+  }
+};
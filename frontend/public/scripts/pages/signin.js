@@ -20,8 +20,13 @@ const SignIn = {
         <input name="password" type="password" placeholder="Password" />
         <span class="error" data-for="password"></span>
 
+        <label class="remember-me">
+          <input name="remember_me" type="checkbox" /> Remember me
+        </label>
+
         <button type="submit">Login</button>
       </form>
+      <p><a href="/password/reset" data-link>Forgot your password?</a></p>
       <p>Don't have an account? <a href="/signup" data-link>SignUp</a></p>
     </div>
     `
@@ -39,7 +44,7 @@ const onSubmit = async (e) => {
   e.preventDefault();
 
   const form = e.target;
-  const { identifier, password } = readFields(form);
+  const { identifier, password, remember_me } = readFields(form);
   clearErrors(form);
 
   const errors = signinValidate({ identifier, password });
@@ -53,6 +58,7 @@ const onSubmit = async (e) => {
     username: isEmail ? "" : identifier,
     email: isEmail ? identifier : "",
     password,
+    remember_me,
   };
 
   const { status, data, error } = await apiRequest("/signin", payload, 'POST');
@@ -71,7 +77,8 @@ const readFields = (form) => {
   const data = new FormData(form);
   return {
     identifier: data.get('identifier')?.trim(),
-    password: data.get('password')
+    password: data.get('password'),
+    remember_me: data.get('remember_me') === 'on',
   };
 };
 
@@ -18,6 +18,7 @@ const SignUp = {
         <span class="error" data-for="last_name"></span><br>
 
         <input name="username" type="text" placeholder="Username">
+        <small class="rules" data-rules-for="username"></small>
         <span class="error" data-for="username"></span><br>
 
         <input name="email" type="email" placeholder="Email">
@@ -34,6 +35,7 @@ const SignUp = {
         <span class="error" data-for="gender"></span><br>
 
         <input name="password" type="password" placeholder="Password">
+        <small class="rules" data-rules-for="password"></small>
         <span class="error" data-for="password"></span><br>
 
         <input name="repeated_password" type="password" placeholder="Confirm Password">
@@ -49,9 +51,13 @@ const SignUp = {
   setup: () => {
     const form = document.getElementById('signupForm');
     form.addEventListener('submit', onSubmit);
+    loadPolicy();
   }
 };
 
+// rules served by the backend (GET /policy), null until loaded
+let policy = null;
+
 // === HELPERS ===
 
 const onSubmit = async (e) => {
@@ -72,6 +78,8 @@ const onSubmit = async (e) => {
   if (status === 201 || status === 200) {
     PopupMessage("User created successfully. Please sign in.", 'success');
     Browse("/signin");
+  } else if (data?.error?.fields) {
+    showErrors(form, data.error.fields);
   } else {
     handleError({ status, message: error || data });
   }
@@ -116,17 +124,70 @@ const handleError = (err) => {
   }
 };
 
+const loadPolicy = async () => {
+  const { status, data } = await apiRequest('/policy', undefined, 'GET');
+  if (status !== 200) return;
+  policy = data;
+
+  const rules = describePolicy(policy);
+  for (const key in rules) {
+    const hint = document.querySelector(`.rules[data-rules-for="${key}"]`);
+    if (hint) hint.textContent = rules[key];
+  }
+};
+
+const describePolicy = ({ password, username }) => {
+  const required = [
+    password.require_upper && 'an uppercase letter',
+    password.require_lower && 'a lowercase letter',
+    password.require_digit && 'a digit',
+    password.require_special && `one of ${password.special_chars}`,
+  ].filter(Boolean);
+
+  let passwordRules = `${password.min_length}-${password.max_length} characters`;
+  if (required.length) passwordRules += `, with ${required.join(', ')}`;
+  if (password.reject_breached) passwordRules += '. Passwords known from data breaches are refused';
+
+  const letters = username.allow_unicode ? 'letters' : 'latin letters';
+  return {
+    username: `${username.min_length}-${username.max_length} characters: ${letters}, numbers and _`,
+    password: passwordRules + '.',
+  };
+};
+
+// with the policy loaded, only lengths are checked here: the backend applies
+// the full rules and reports them per field
+const lengthBetween = (value, min, max) => {
+  const length = [...(value || '')].length;
+  return length >= min && length <= max;
+};
+
 const signupValidate = (userInfo) => {
   const errors = {};
 
-  if (!/^[A-Za-z]{3,}$/.test(userInfo.first_name || ''))
-    errors.first_name = 'First name must be 3+ letters';
+  if (policy) {
+    const { name, username, password } = policy;
+    if (!lengthBetween(userInfo.first_name, name.min_length, name.max_length))
+      errors.first_name = `First name must be ${name.min_length}-${name.max_length} characters`;
+    if (!lengthBetween(userInfo.last_name, name.min_length, name.max_length))
+      errors.last_name = `Last name must be ${name.min_length}-${name.max_length} characters`;
+    if (!lengthBetween(userInfo.username, username.min_length, username.max_length))
+      errors.username = `Username must be ${username.min_length}-${username.max_length} characters`;
+    if (!lengthBetween(userInfo.password, password.min_length, password.max_length))
+      errors.password = `Password must be ${password.min_length}-${password.max_length} characters`;
+  } else {
+    if (!/^[A-Za-z]{3,}$/.test(userInfo.first_name || ''))
+      errors.first_name = 'First name must be 3+ letters';
+
+    if (!/^[A-Za-z]{3,}$/.test(userInfo.last_name || ''))
+      errors.last_name = 'Last name must be 3+ letters';
 
-  if (!/^[A-Za-z]{3,}$/.test(userInfo.last_name || ''))
-    errors.last_name = 'Last name must be 3+ letters';
+    if (!/^[A-Za-z0-9_]{3,20}$/.test(userInfo.username || ''))
+      errors.username = 'Username 3-20 chars, letters/numbers/_ only';
 
-  if (!/^[A-Za-z0-9_]{3,20}$/.test(userInfo.username || ''))
-    errors.username = 'Username 3-20 chars, letters/numbers/_ only';
+    if (!/^.*(?=.{8,})(?=.*[A-Z])(?=.*\d)(?=.*[!@#$%^&*()_\-+=]).*$/.test(userInfo.password || ''))
+      errors.password = 'Password 8+ chars, include upper, digit & special';
+  }
 
   if (!/^[^\s@]+@[^\s@]+\.[^\s@]+$/.test(userInfo.email || ''))
     errors.email = 'Invalid email';
@@ -143,9 +204,6 @@ const signupValidate = (userInfo) => {
   if (!/^(male|female)$/.test(userInfo.gender || ''))
     errors.gender = 'Select male or female';
 
-  if (!/^.*(?=.{8,})(?=.*[A-Z])(?=.*\d)(?=.*[!@#$%^&*()_\-+=]).*$/.test(userInfo.password || ''))
-    errors.password = 'Password 8+ chars, include upper, digit & special';
-
   if (userInfo.repeated_password !== userInfo.password)
     errors.repeated_password = 'Passwords do not match';
 
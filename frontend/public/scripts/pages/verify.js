@@ -0,0 +1,44 @@
+import { apiRequest } from '../tools.js';
+
+export { VerifyEmail }
+
+// Opened from the emailed link (/verify-email?token=...): confirms the
+// address right away, signed in or not.
+const VerifyEmail = {
+    html: `
+    <head>
+      <link rel="stylesheet" href="/public/styles/account.css">
+    </head>
+    <div id="verify" class="account-card">
+      <h1>Email Verification</h1>
+      <p id="verify-status">Confirming your email address…</p>
+      <p><a id="verify-next" class="hidden" data-link></a></p>
+    </div>
+    `
+  ,
+
+  setup: async () => {
+    const status = document.getElementById('verify-status');
+    const token = new URLSearchParams(window.location.search).get('token');
+    if (!token) {
+      status.textContent = 'This verification link is incomplete. Please open the link from the email again.';
+      return;
+    }
+
+    const { status: code } = await apiRequest('/verify-email', { token }, 'POST');
+    if (code === 200) {
+      status.textContent = 'Your email address is confirmed. You can now post, comment and chat.';
+    } else if (code === 400) {
+      status.textContent = 'This verification link is invalid or expired. Sign in and ask for a new one.';
+    } else {
+      status.textContent = 'Something went wrong. Please try again later.';
+    }
+
+    // signed in users go on to the forum, others sign in first
+    const next = document.getElementById('verify-next');
+    const signedIn = !!localStorage.getItem('token');
+    next.href = signedIn ? '/' : '/signin';
+    next.textContent = signedIn ? 'Go to the forum' : 'Sign in';
+    next.classList.remove('hidden');
+  }
+};
@@ -3,6 +3,8 @@ import { Home } from './pages/home/home.js';
 import { SignUp } from './pages/signup.js';
 import { SignIn } from './pages/signin.js';
 import { NewPost } from './pages/newpost.js';
+import { ResetPassword } from './pages/reset.js';
+import { VerifyEmail } from './pages/verify.js';
 import { apiRequest } from './tools.js';
 import { ThemeToggle } from './pages/home/nav.js';
 export { Browse, RenderRoute }
@@ -12,7 +14,12 @@ const routes = {
   '/signup': SignUp,
   '/signin': SignIn,
   '/newpost': NewPost,
+  '/password/reset': ResetPassword,
+  '/verify-email': VerifyEmail,
 };
+
+// pages reachable while signed out, e.g. from emailed links
+const publicPages = ['/signin', '/signup', '/password/reset', '/verify-email'];
  // TODO user must logout from all pages  which means add navbar to all pages
 const Browse = (path) => {
   history.pushState({}, '', path);
@@ -24,7 +31,7 @@ const RenderRoute = (path = window.location.pathname) => {
   const app = document.getElementById('app');
 ThemeToggle()
 
-  if (path !== '/signin' && path !== '/signup') {
+  if (!publicPages.includes(path)) {
     const token = localStorage.getItem('token');
     if (!token) {
       apiRequest('/signout', {}, 'DELETE')
@@ -1,11 +1,16 @@
-export { apiRequest, timeAgo, PopupMessage}
+export { apiRequest, refreshSession, timeAgo, PopupMessage}
 
-// Reusable API request helper (JSON + credentials + error with status)
+// requests that must not trigger a session refresh when they answer 401
+const noRefresh = ['/signin', '/signin/2fa', '/signup', '/refresh', '/signout'];
+
+// Reusable API request helper (JSON + credentials + error with status).
+// An expired session is renewed once with the "remember me" refresh token
+// and the request sent again.
 async function apiRequest(url, data, method = 'POST', extraHeaders = {}, log = false) {
   if (log) console.log({ url, data, method });
 
   try {
-    const response = await fetch(url, {
+    const send = () => fetch(url, {
       method,
       headers: {
         'Content-Type': 'application/json',
@@ -15,6 +20,11 @@ async function apiRequest(url, data, method = 'POST', extraHeaders = {}, log = f
       body: JSON.stringify(data),
     });
 
+    let response = await send();
+    if (response.status === 401 && !noRefresh.includes(url) && await refreshSession()) {
+      response = await send();
+    }
+
     // If there's no content (204), return a special marker
     if (response.status === 204) return { status: 204, data: null };
 
@@ -38,6 +48,22 @@ async function apiRequest(url, data, method = 'POST', extraHeaders = {}, log = f
 
 
 
+// pending refresh, shared so concurrent 401s only rotate the token once
+let refreshing = null;
+
+// refreshSession trades the refresh_token cookie for a new session and
+// tells whether it worked. 409 means another tab rotated the token a moment
+// ago: the browser already holds the new cookies.
+const refreshSession = () => {
+  if (!refreshing) {
+    refreshing = fetch('/refresh', { method: 'POST', credentials: 'include' })
+      .then(res => res.ok || res.status === 409)
+      .catch(() => false)
+      .finally(() => { refreshing = null; });
+  }
+  return refreshing;
+};
+
 // add one listener to multiple event types on any EventTarget [element window document htmele ...]
 EventTarget.prototype.addMultiEventListener = function (events, callback, options) {
   events.forEach(event => this.addEventListener(event, callback, options));